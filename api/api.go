@@ -4,12 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
+	"io/ioutil"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"nanny/pkg/calendar"
 	"nanny/pkg/closer"
+	"nanny/pkg/cron"
 	"nanny/pkg/nanny"
 	"nanny/pkg/notifier"
 	"nanny/pkg/storage"
@@ -25,6 +30,14 @@ type Server struct {
 	Name      string          // Name of this Nanny.
 	Notifiers notifiers       // Enabled notifiers.
 	Storage   storage.Storage // What to use as persistence system.
+	// Optional holiday calendars signals may refer to by their names.
+	Calendars map[string]*calendar.Calendar
+	// Optional profiles of signal settings, see Profile.
+	Profiles []Profile
+	// Optional signals expected since start, see Declared.
+	Signals []Declared
+	// Policy of resolving identity of callers, see Identity.
+	Identity Identity
 
 	nanny nanny.Nanny
 }
@@ -33,14 +46,165 @@ type Server struct {
 type Signal struct {
 	// Name of program being monitored.
 	// IP address of caller is appended to the name so it may be non-unique.
-	Name     string `json:"name"`
-	Notifier string `json:"notifier"` // What notifier to use.
+	Name string `json:"name"`
+	// Optional name of profile from config providing defaults of other fields,
+	// see Profile.
+	Profile string `json:"profile"`
+	// What notifier to use, may be a single notifier or a list of them.
+	Notifier NotifierList `json:"notifier"`
 	// After how many seconds to expect next call.
-	// May contain "10s", "1h": https://golang.org/pkg/time/#ParseDuration
+	// May contain "10s", "1h": https://golang.org/pkg/time/#ParseDuration, number
+	// of seconds, ISO 8601 duration "PT15M" or RFC3339 time of the next call.
 	NextSignal string `json:"next_signal"`
+	// Optional grace period after next_signal before the program is considered
+	// silent, a duration like next_signal, not a time.
+	Grace string `json:"grace"`
 	// Activate optional all-clear notification that is sent when a call is received after an alert was sent
-	AllClear bool              `json:"all_clear"`
-	Meta     map[string]string `json:"meta"` // Metadata for this signal, may contain custom data.
+	AllClear bool `json:"all_clear"`
+	// Optional interval to repeat the notification until program calls again, a
+	// duration like next_signal, not a time.
+	Repeat string `json:"repeat"`
+	// Optional escalation steps following the first notification.
+	Escalation []EscalationStep  `json:"escalation"`
+	Meta       map[string]string `json:"meta"` // Metadata for this signal, may contain custom data.
+	// Optional cron expression of the program's schedule, e.g. "0 2 * * *". When
+	// set, next signal is expected at the next scheduled time, next_signal is
+	// not needed.
+	Schedule string `json:"schedule"`
+	// Time zone of the schedule or interval rules, e.g. "Europe/Prague". Defaults
+	// to UTC.
+	Timezone string `json:"timezone"`
+	// How long after the scheduled time the program may signal, a duration like
+	// next_signal, not a time.
+	Tolerance string `json:"tolerance"`
+	// Optional default maximum runtime of the program's runs, see Run.
+	MaxRuntime string `json:"max_runtime"`
+	// Optional names of signals this program depends on. While any of them is
+	// alerting, alerts of this program are held back and mentioned in theirs.
+	DependsOn []string `json:"depends_on"`
+	// Optional flap detection: the signal is flapping when it changed between
+	// alerting and recovered flap_threshold times within flap_window.
+	FlapWindow    string `json:"flap_window"`
+	FlapThreshold int    `json:"flap_threshold"`
+	// Optional hysteresis of all-clear notification, it is sent after the program
+	// called stable_pings times or for stable_for after recovery.
+	StablePings int    `json:"stable_pings"`
+	StableFor   string `json:"stable_for"`
+	// Optional detection of program calling too often: sooner than min_interval
+	// after the previous call, or more than max_rate times within rate_window.
+	MinInterval string `json:"min_interval"`
+	MaxRate     int    `json:"max_rate"`
+	RateWindow  string `json:"rate_window"`
+	// Optional inverse mode: the program should never call, any call notifies
+	// right away. Calls within cooldown do not notify again, the program is fine
+	// once it does not call for cooldown. next_signal is not used.
+	Inverse  bool   `json:"inverse"`
+	Cooldown string `json:"cooldown"`
+	// Optional throughput floor: the program must report at least min_throughput
+	// events within throughput_window. Each call reports count events, one by
+	// default. next_signal is not used.
+	MinThroughput    int    `json:"min_throughput"`
+	ThroughputWindow string `json:"throughput_window"`
+	Count            *int   `json:"count"`
+	// Optional numeric values reported by the program, e.g. {"records": 120},
+	// checked by assertions such as "records > 0". Call whose values fail any
+	// assertion notifies right away, like a failure of the program.
+	Values     map[string]float64 `json:"values"`
+	Assertions []string           `json:"assertions"`
+	// Optional stall detection: progress, a counter or percentage reported by
+	// the program, must move at least every stall_after.
+	StallAfter string   `json:"stall_after"`
+	Progress   *float64 `json:"progress"`
+	// Optional anomaly detection of runs: user is notified when a run takes
+	// longer than runtime_factor times the 95th percentile of previous runtimes.
+	RuntimeFactor float64 `json:"runtime_factor"`
+	// Optional learning of the interval when next_signal is not set: interval and
+	// its tolerance, used when grace is not set, are learned from the first
+	// learn_pings calls.
+	LearnPings int `json:"learn_pings"`
+	// Optional interval rules, the first rule matching time of the call in
+	// timezone sets when to expect the next call, next_signal is used when none
+	// matches. Holidays is name of a holiday calendar from config, its days are
+	// matched only by rules for "holiday".
+	IntervalRules []IntervalRule `json:"interval_rules"`
+	Holidays      string         `json:"holidays"`
+}
+
+// IntervalRule represents incomming JSON-encoded interval rule of a signal.
+type IntervalRule struct {
+	// Days of week like "mon", ranges like "mon-fri" and "holiday". All days when
+	// empty.
+	Days []string `json:"days"`
+	// Optional time of day range like "08:00" to "18:00", to is exclusive. The
+	// range wraps around midnight when to is not after from.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// When to expect next call, a duration like next_signal of the signal, not a
+	// time.
+	NextSignal string `json:"next_signal"`
+}
+
+// Run represents incomming JSON-encoded start of the program's run.
+type Run struct {
+	// Maximum runtime of this run, a duration like next_signal, not a time.
+	// Defaults to the signal's max_runtime.
+	MaxRuntime string `json:"max_runtime"`
+}
+
+// NotifierList is a list of notifier names, which may be encoded in JSON as
+// a single string or as a list of strings.
+type NotifierList []string
+
+// UnmarshalJSON accepts both "notifier" and ["notifier", "other"].
+func (l *NotifierList) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*l = NotifierList{name}
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return errors.New("notifier must be a string or a list of strings")
+	}
+	*l = NotifierList(names)
+	return nil
+}
+
+// MarshalJSON encodes single notifier as a string, more of them as a list.
+func (l NotifierList) MarshalJSON() ([]byte, error) {
+	if len(l) == 1 {
+		return json.Marshal(l[0])
+	}
+	return json.Marshal([]string(l))
+}
+
+// EscalationStep represents incomming JSON-encoded escalation step.
+type EscalationStep struct {
+	// When to start this step, counted from the first notification.
+	After    string `json:"after"`
+	Notifier string `json:"notifier"` // What notifier to use.
+	// Optional interval to repeat the notification until the next step.
+	Repeat string `json:"repeat"`
+}
+
+// Failure represents incomming JSON-encoded failure of the program.
+type Failure struct {
+	ExitCode int    `json:"exit_code"`
+	Log      string `json:"log"` // Optional log excerpt, truncated to maxLogLength.
+}
+
+// maxLogLength is maximum length of failure log excerpt in bytes, longer logs are
+// truncated, keeping the end of the log.
+const maxLogLength = 4096
+
+// Ack represents incomming JSON-encoded acknowledgement of an alerting signal.
+type Ack struct {
+	Who  string `json:"who"`  // Who acknowledged the alert.
+	Note string `json:"note"` // Optional note, e.g. what is being done.
+	// Optional expiry of the acknowledgement, either RFC3339 time or a duration
+	// like "2h" counted from now. Reminders and escalation continue afterwards.
+	Until string `json:"until"`
 }
 
 // Error represents JSON error to be sent to user.
@@ -79,89 +243,41 @@ func (a *Server) Handler() (http.Handler, error) {
 	if a.Name != "" {
 		a.nanny.Name = a.Name
 	}
+	a.nanny.Calendars = a.Calendars
+	profiles, err := newProfiles(a.Profiles, &a.nanny, a.Notifiers)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := newIdentity(a.Identity)
+	if err != nil {
+		return nil, err
+	}
 
 	a.nanny.ErrorFunc = func(err error) {
 		log.Error("Notify error", "err", err)
 	}
-
-	// Load persisted signals, if any.
-	loadStorage(&a.nanny, a.Notifiers, a.Storage)
-	return router(&a.nanny, a.Notifiers, a.Storage), nil
-}
-
-// loadStorage loads persisted signals. This function does not return error but logs
-// information directly (for better error messages).
-func loadStorage(n *nanny.Nanny, notifiers notifiers, store storage.Storage) {
-	signals, err := store.Load()
-	if err != nil {
-		msg := "Unable to load persisted signals. " +
-			"There may have been saved signals you will not be notified about! " +
-			"Please check services using Nanny manually."
-		log.Warn(msg)
-		return
+	// Persist every state change, so that alerting signals survive restart.
+	a.nanny.ChangeFunc = func(timer *nanny.Timer) {
+		saveSignal(a.Storage, timer)
 	}
-	// create callback func using our storage.
-	callbackFunc := makeCallbackFunc(store)
-
-	// Create nanny timers from persisted signals.
-	for _, signal := range signals {
-		// If NextSignal would be in the past, notify user, and delete it.
-		if signal.NextSignal.Before(time.Now()) {
-			msg := "Found previously stored notifier that is stale. Please check " +
-				"this program manually."
-			log.Warn(msg, "program", signal.Name, "should_notify", signal.NextSignal.String())
-			err = store.Remove(signal)
-			if err != nil {
-				log.Error("Unable to remove stale signal.", "err", err)
-			}
-			continue
-		}
-
-		notif, ok := notifiers[signal.Notifier]
-		if !ok {
-			msg := "Unable to find previously stored notifier. It may have been " +
-				"disabled. Please check this program manually."
-			log.Warn(msg, "program", signal.Name)
-		}
-		s := nanny.Signal{
-			Name:       signal.Name,
-			Notifier:   notif,
-			NextSignal: time.Until(signal.NextSignal),
-			AllClear:   signal.AllClear,
-			Meta:       signal.Meta,
-
-			CallbackFunc: callbackFunc,
-		}
-
-		err = n.Handle(s)
-		if err != nil {
-			msg := "Unable to create signal handler from previous run," +
-				" please check this program manually."
-			log.Warn(msg, "program", signal.Name, "err", err)
-			continue
-		}
-		log.Info("Loaded persisted signal successful.",
-			"program", signal.Name,
-			"next_signal", s.NextSignal.String(),
-			"all_clear", s.AllClear,
-			"meta", s.Meta,
-			"notifier", signal.Notifier)
+	a.nanny.QuorumChangeFunc = func(q *nanny.Quorum) {
+		saveGroup(a.Storage, q)
 	}
-}
 
-// makeCallbackFunc creates new function that can be used as nanny.Signal callback
-// while injecting storage dependency. This is used to remove signal from persistent
-// storage.
-func makeCallbackFunc(store storage.Storage) func(*nanny.Signal) {
-	return func(signal *nanny.Signal) {
-		err := store.Remove(storage.Signal{Name: signal.Name})
-		if err != nil {
-			log.Error("Error removing signal from storage.", "err", err, "signal", signal)
-		}
+	// Load persisted silences, signals and groups, if any. Silences go first, so
+	// that restored alerting signals respect them, declared signals follow the
+	// restored ones, groups go last to count restored members.
+	loadSilences(&a.nanny, a.Storage)
+	loadStorage(&a.nanny, a.Notifiers, a.Storage, declaredNames(a.Signals))
+	err = loadDeclared(&a.nanny, a.Notifiers, a.Storage, profiles, a.Signals)
+	if err != nil {
+		return nil, err
 	}
+	loadGroups(&a.nanny, a.Notifiers, a.Storage)
+	return router(&a.nanny, a.Notifiers, a.Storage, profiles, identity), nil
 }
 
-func router(nanny *nanny.Nanny, notifiers notifiers, store storage.Storage) *mux.Router {
+func router(nanny *nanny.Nanny, notifiers notifiers, store storage.Storage, profiles profiles, identity *Identity) *mux.Router {
 	router := mux.NewRouter()
 	// Clarify this is API.
 	apiRouter := router.PathPrefix("/api").Subrouter()
@@ -170,7 +286,25 @@ func router(nanny *nanny.Nanny, notifiers notifiers, store storage.Storage) *mux
 	// In case of future API changes, nanny will support older versions of API.
 	v1Router := apiRouter.PathPrefix("/v1").Subrouter()
 	v1Router.Handle("/signals", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, getSignalsHandler))))).Name("Show all registered signals.").Methods("GET")
-	v1Router.Handle("/signal", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, signalHandler))))).Name("Register new signal.").Methods("POST")
+	v1Router.Handle("/signal", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, profileWrap(profiles, identityWrap(identity, signalHandler))))))).Name("Register new signal.").Methods("POST")
+	v1Router.Handle("/signal/{name}", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, deleteSignalHandler))))).Name("Remove registered signal.").Methods("DELETE")
+	v1Router.Handle("/signal/{name}/pause", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, pauseSignalHandler))))).Name("Pause registered signal.").Methods("POST")
+	v1Router.Handle("/signal/{name}/resume", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, resumeSignalHandler))))).Name("Resume paused signal.").Methods("POST")
+	v1Router.Handle("/silences", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, createSilenceHandler))))).Name("Create new silence.").Methods("POST")
+	v1Router.Handle("/silences", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, getSilencesHandler))))).Name("Show all silences.").Methods("GET")
+	v1Router.Handle("/silences/{id}", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, updateSilenceHandler))))).Name("Update silence.").Methods("PUT")
+	v1Router.Handle("/silences/{id}", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, deleteSilenceHandler))))).Name("Remove silence.").Methods("DELETE")
+	v1Router.Handle("/silences/{id}", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, getSilenceHandler))))).Name("Show silence.").Methods("GET")
+	v1Router.Handle("/signal/{name}/start", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, startSignalHandler))))).Name("Start run of registered signal.").Methods("POST")
+	v1Router.Handle("/signal/{name}/finish", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, finishSignalHandler))))).Name("Finish run of registered signal.").Methods("POST")
+	v1Router.Handle("/signal/{name}/stats", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, getStatsHandler))))).Name("Show run statistics of registered signal.").Methods("GET")
+	v1Router.Handle("/signal/{name}/interval", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, intervalSignalHandler))))).Name("Override learned interval of registered signal.").Methods("POST")
+	v1Router.Handle("/signal/{name}/fail", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, failSignalHandler))))).Name("Report failure of registered signal.").Methods("POST")
+	v1Router.Handle("/signal/{name}/ack", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, ackSignalHandler))))).Name("Acknowledge alerting signal.").Methods("POST")
+	v1Router.Handle("/groups", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, groupHandler))))).Name("Create or update group.").Methods("POST")
+	v1Router.Handle("/groups", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, getGroupsHandler))))).Name("Show all groups.").Methods("GET")
+	v1Router.Handle("/groups/{name}", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, deleteGroupHandler))))).Name("Remove group.").Methods("DELETE")
+	v1Router.Handle("/groups/{name}", panicWrap(headerWrap(errWrap(depWrap(nanny, notifiers, store, getGroupHandler))))).Name("Show group.").Methods("GET")
 
 	err := router.Walk(saveRoutes)
 	if err != nil {
@@ -202,15 +336,22 @@ func versionHandler(w http.ResponseWriter, req *http.Request) error {
 	return errors.Wrap(err, "unable to reply with version")
 }
 
-// signalHandler handles incomming register/ping signal from a source.
-func signalHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+// signalHandler handles incomming register/ping signal from a source. Signal
+// using a profile is decoded on top of it.
+func signalHandler(identity *Identity, profiles profiles, n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
 	w.Header().Set("Content-Type", "application/json")
 	var signal Signal
 
-	dec := json.NewDecoder(req.Body)
 	defer closer.Close(req.Body)
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        errors.Wrap(err, "unable to read request"),
+		}
+	}
 
-	err := dec.Decode(&signal)
+	err = json.Unmarshal(data, &signal)
 	if err != nil {
 		return &httpError{
 			StatusCode: http.StatusBadRequest,
@@ -218,46 +359,323 @@ func signalHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w
 		}
 	}
 
-	notif, ok := notifiers[signal.Notifier]
-	if !ok {
+	err = profiles.apply(data, &signal)
+	if err != nil {
 		return &httpError{
 			StatusCode: http.StatusBadRequest,
-			Err:        errors.Errorf("unable to find notifier: %s", signal.Notifier),
+			Err:        err,
 		}
 	}
 
-	s := constructSignal(signal, notif, store, req)
+	name, caller := identity.constructName(signal.Name, req, signal.Meta)
+	s, err := buildSignal(n, notifiers, signal, name)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        err,
+		}
+	}
+	s.Identity = caller
 	err = n.Handle(s)
 	if err != nil {
 		return errors.Wrap(err, "unable to handle signal")
 	}
 
-	err = store.Save(storage.Signal{
-		Name:       s.Name,
-		Notifier:   signal.Notifier,
-		NextSignal: time.Now().Add(s.NextSignal),
-		AllClear:   s.AllClear,
-		Meta:       s.Meta,
-	})
+	// Errors are not on the API but only logged. Notifications will still work.
+	saveSignal(store, n.GetTimer(s.Name))
+	// When everything is OK, we should return JSON with "status_code": 200, and
+	// message "status": "OK".
+	// nolint: errcheck
+	w.Write([]byte(`{"status_code":200, "status":"OK"}`))
+	return nil
+}
 
-	// This error should not be on the API but only logged. Notifications will still
-	// work.
+// buildSignal constructs nanny signal of given name from JSON signal.
+func buildSignal(n *nanny.Nanny, notifiers notifiers, signal Signal, name string) (nanny.Signal, error) {
+	notifs, err := constructNotifiers(signal.Notifier, notifiers)
 	if err != nil {
-		log.Error("Error saving signal to persistent storage", "err", err)
+		return nanny.Signal{}, err
 	}
-	// When everything is OK, we should return JSON with "status_code": 200, and
-	// message "status": "OK".
+
+	escalation, err := constructEscalation(signal.Escalation, notifiers)
+	if err != nil {
+		return nanny.Signal{}, err
+	}
+
+	schedule, loc, err := constructSchedule(signal.Schedule, signal.Timezone)
+	if err != nil {
+		return nanny.Signal{}, err
+	}
+
+	assertions, err := constructAssertions(signal.Assertions)
+	if err != nil {
+		return nanny.Signal{}, err
+	}
+
+	rules, err := constructIntervalRules(signal.IntervalRules)
+	if err != nil {
+		return nanny.Signal{}, err
+	}
+	if len(rules) > 0 && loc == nil {
+		loc, err = constructLocation(signal.Timezone)
+		if err != nil {
+			return nanny.Signal{}, err
+		}
+	}
+
+	holidays, err := constructHolidays(signal.Holidays, n.Calendars)
+	if err != nil {
+		return nanny.Signal{}, err
+	}
+
+	s, err := constructSignal(signal, name, notifs, escalation)
+	if err != nil {
+		return nanny.Signal{}, err
+	}
+	s.Schedule = schedule
+	s.Location = loc
+	s.Assertions = assertions
+	s.Rules = rules
+	s.Holidays = holidays
+	return s, nil
+}
+
+// deleteSignalHandler removes signal from nanny and persistent storage. Name must
+// be the full signal name, as shown in signals listing.
+func deleteSignalHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(req)["name"]
+
+	if !n.Remove(name) {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find signal: %s", name),
+		}
+	}
+
+	err := store.Remove(storage.Signal{Name: name})
+	// This error should not be on the API but only logged, signal is removed
+	// from nanny already.
+	if err != nil {
+		log.Error("Error removing signal from persistent storage", "err", err)
+	}
+	// nolint: errcheck
+	w.Write([]byte(`{"status_code":200, "status":"OK"}`))
+	return nil
+}
+
+// pauseSignalHandler pauses signal, it will not notify until resumed.
+func pauseSignalHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(req)["name"]
+
+	if !n.Pause(name) {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find signal: %s", name),
+		}
+	}
+	saveSignal(store, n.GetTimer(name))
+	// nolint: errcheck
+	w.Write([]byte(`{"status_code":200, "status":"OK"}`))
+	return nil
+}
+
+// resumeSignalHandler resumes paused signal.
+func resumeSignalHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(req)["name"]
+
+	if !n.Resume(name) {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find signal: %s", name),
+		}
+	}
+	saveSignal(store, n.GetTimer(name))
+	// nolint: errcheck
+	w.Write([]byte(`{"status_code":200, "status":"OK"}`))
+	return nil
+}
+
+// startSignalHandler starts run of the signal, user is notified when the run
+// does not finish within its maximum runtime.
+func startSignalHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(req)["name"]
+	var run Run
+
+	dec := json.NewDecoder(req.Body)
+	defer closer.Close(req.Body)
+
+	// Body is optional, signal's max_runtime is used by default.
+	err := dec.Decode(&run)
+	if err != nil && err != io.EOF {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        errors.Wrap(err, "unable to decode JSON"),
+		}
+	}
+	maxRuntime, err := constructDuration(run.MaxRuntime)
+	if err != nil || run.MaxRuntime != "" && maxRuntime <= 0 {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        errors.Errorf("invalid max_runtime: %s", run.MaxRuntime),
+		}
+	}
+
+	timer := n.GetTimer(name)
+	if timer == nil {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find signal: %s", name),
+		}
+	}
+	err = timer.Start(maxRuntime)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        errors.Wrapf(err, "unable to start run of signal: %s", name),
+		}
+	}
+	saveSignal(store, timer)
+	// nolint: errcheck
+	w.Write([]byte(`{"status_code":200, "status":"OK"}`))
+	return nil
+}
+
+// finishSignalHandler finishes run of the signal, the runtime is returned.
+func finishSignalHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(req)["name"]
+
+	timer := n.GetTimer(name)
+	if timer == nil {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find signal: %s", name),
+		}
+	}
+	runtime, err := timer.Finish()
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusConflict,
+			Err:        errors.Wrapf(err, "unable to finish run of signal: %s", name),
+		}
+	}
+	saveSignal(store, timer)
+	saveRun(store, name, runtime)
+	fmt.Fprintf(w, `{"status_code":200, "status":"OK", "runtime":%q}`, runtime.String())
+	return nil
+}
+
+// failSignalHandler reports failure of the program, user is notified immediately.
+func failSignalHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(req)["name"]
+	var failure Failure
+
+	dec := json.NewDecoder(req.Body)
+	defer closer.Close(req.Body)
+
+	err := dec.Decode(&failure)
+	if err != nil && err != io.EOF {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        errors.Wrap(err, "unable to decode JSON"),
+		}
+	}
+	if len(failure.Log) > maxLogLength {
+		failure.Log = failure.Log[len(failure.Log)-maxLogLength:]
+		// Do not start in the middle of a character.
+		for len(failure.Log) > 0 && !utf8.RuneStart(failure.Log[0]) {
+			failure.Log = failure.Log[1:]
+		}
+	}
+
+	timer := n.GetTimer(name)
+	if timer == nil {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find signal: %s", name),
+		}
+	}
+	err = timer.Fail(failure.ExitCode, failure.Log)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusConflict,
+			Err:        errors.Wrapf(err, "unable to report failure of signal: %s", name),
+		}
+	}
+	saveSignal(store, timer)
 	// nolint: errcheck
 	w.Write([]byte(`{"status_code":200, "status":"OK"}`))
 	return nil
 }
 
+// ackSignalHandler acknowledges alerting signal, stopping its reminders and
+// escalation until the acknowledgement expires or the program recovers.
+func ackSignalHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(req)["name"]
+	var ack Ack
+
+	dec := json.NewDecoder(req.Body)
+	defer closer.Close(req.Body)
+
+	// Body is optional, anonymous acknowledgement is fine.
+	err := dec.Decode(&ack)
+	if err != nil && err != io.EOF {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        errors.Wrap(err, "unable to decode JSON"),
+		}
+	}
+
+	now := time.Now()
+	until, err := constructUntil(ack.Until, now)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        err,
+		}
+	}
+
+	timer := n.GetTimer(name)
+	if timer == nil {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find signal: %s", name),
+		}
+	}
+	err = timer.Acknowledge(nanny.Ack{By: ack.Who, Note: ack.Note, At: now, Until: until})
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusConflict,
+			Err:        errors.Wrapf(err, "unable to acknowledge signal: %s", name),
+		}
+	}
+	saveSignal(store, timer)
+	// nolint: errcheck
+	w.Write([]byte(`{"status_code":200, "status":"OK"}`))
+	return nil
+}
+
+// getSignalsHandler lists registered signals, optionally filtered by their state
+// using "state" query parameter, e.g. ?state=late,alerting.
 func getSignalsHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
 	w.Header().Set("Content-Type", "application/json")
 
-	signals := n.GetTimers()
+	states, err := parseStates(req.URL.Query()["state"])
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        err,
+		}
+	}
+	signals := filterTimers(n.GetTimers(), states)
 
-	err := json.NewEncoder(w).Encode(&struct {
+	err = json.NewEncoder(w).Encode(&struct {
 		NannyName string         `json:"nanny_name"`
 		Programs  []*nanny.Timer `json:"signals"`
 	}{
@@ -274,61 +692,336 @@ func getSignalsHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storag
 	return nil
 }
 
-func constructSignal(jsonSignal Signal, notif notifier.Notifier, store storage.Storage, req *http.Request) nanny.Signal {
+// parseStates parses "state" query parameter values, each value may contain more
+// states separated by comma.
+func parseStates(values []string) (map[nanny.State]bool, error) {
+	states := make(map[nanny.State]bool)
+	for _, value := range values {
+		for _, state := range strings.Split(value, ",") {
+			switch s := nanny.State(strings.TrimSpace(state)); s {
+			case nanny.StateWaiting, nanny.StateLate, nanny.StateAlerting, nanny.StateRecovered, nanny.StatePaused:
+				states[s] = true
+			default:
+				return nil, errors.Errorf("unknown state: %s", state)
+			}
+		}
+	}
+	return states, nil
+}
+
+// filterTimers returns timers in given states, or all timers when no state is
+// given.
+func filterTimers(timers []*nanny.Timer, states map[nanny.State]bool) []*nanny.Timer {
+	if len(states) == 0 {
+		return timers
+	}
+	filtered := make([]*nanny.Timer, 0, len(timers))
+	for _, timer := range timers {
+		if states[timer.State()] {
+			filtered = append(filtered, timer)
+		}
+	}
+	return filtered
+}
+
+// constructSignal creates signal from its JSON representation, returns error when
+// any of its durations is invalid.
+func constructSignal(jsonSignal Signal, name string, notifs []notifier.Notifier, escalation []nanny.EscalationStep) (nanny.Signal, error) {
+	nextSignal, deadline, err := constructNextSignal(jsonSignal.NextSignal, time.Now())
+	if err != nil {
+		return nanny.Signal{}, err
+	}
+	var d durations
 	s := nanny.Signal{
-		Name:       constructName(jsonSignal.Name, req),
-		Notifier:   notif,
-		NextSignal: constructDuration(jsonSignal.NextSignal),
+		Name:       name,
+		Notifier:   notifs[0],
+		Notifiers:  notifs[1:],
+		NextSignal: nextSignal,
+		Deadline:   deadline,
+		Grace:      d.parse("grace", jsonSignal.Grace),
 		AllClear:   jsonSignal.AllClear,
+		Repeat:     d.parse("repeat", jsonSignal.Repeat),
+		Escalation: escalation,
 		Meta:       jsonSignal.Meta,
+		Tolerance:  d.parse("tolerance", jsonSignal.Tolerance),
+		MaxRuntime: d.parse("max_runtime", jsonSignal.MaxRuntime),
+		DependsOn:  jsonSignal.DependsOn,
 
-		CallbackFunc: func(s *nanny.Signal) {
-			err := store.Remove(storage.Signal{Name: s.Name})
-			if err != nil {
-				log.Error("Error removing signal from storage.", "err", err, "signal", jsonSignal)
-			}
-		},
+		FlapWindow:    d.parse("flap_window", jsonSignal.FlapWindow),
+		FlapThreshold: jsonSignal.FlapThreshold,
+		StablePings:   jsonSignal.StablePings,
+		StableFor:     d.parse("stable_for", jsonSignal.StableFor),
+
+		MinInterval: d.parse("min_interval", jsonSignal.MinInterval),
+		MaxRate:     jsonSignal.MaxRate,
+		RateWindow:  d.parse("rate_window", jsonSignal.RateWindow),
+
+		Inverse:  jsonSignal.Inverse,
+		Cooldown: d.parse("cooldown", jsonSignal.Cooldown),
+
+		MinThroughput:    jsonSignal.MinThroughput,
+		ThroughputWindow: d.parse("throughput_window", jsonSignal.ThroughputWindow),
+		Count:            1,
+		Values:           jsonSignal.Values,
+		StallAfter:       d.parse("stall_after", jsonSignal.StallAfter),
+		Progress:         jsonSignal.Progress,
+		RuntimeFactor:    jsonSignal.RuntimeFactor,
+		LearnPings:       jsonSignal.LearnPings,
 	}
-	return s
+	if jsonSignal.Count != nil {
+		s.Count = *jsonSignal.Count
+	}
+	return s, d.err
 }
 
-func constructName(name string, req *http.Request) string {
-	dontModifyName := req.Header.Get("X-Dont-Modify-Name")
-	if dontModifyName != "" {
-		return name
+// constructNotifiers looks up notifiers by their names. There is always at least
+// one notifier returned when error is nil.
+func constructNotifiers(names NotifierList, notifiers notifiers) ([]notifier.Notifier, error) {
+	if len(names) == 0 {
+		names = NotifierList{""}
 	}
+	var notifs []notifier.Notifier
+	for _, name := range names {
+		notif, ok := notifiers[name]
+		if !ok {
+			return nil, errors.Errorf("unable to find notifier: %s", name)
+		}
+		notifs = append(notifs, notif)
+	}
+	return notifs, nil
+}
 
-	remoteAddr := req.Header.Get("X-Forwarded-For")
-	if remoteAddr == "" {
-		remoteAddr = req.RemoteAddr
+// constructSchedule parses cron expression and its time zone, nil schedule is
+// returned for empty expression.
+func constructSchedule(expr, timezone string) (*cron.Schedule, *time.Location, error) {
+	if expr == "" {
+		return nil, nil, nil
 	}
+	schedule, err := cron.Parse(expr)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc, err := constructLocation(timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+	return schedule, loc, nil
+}
 
-	// Split addr:port and add address to the name in format {programName}@{addr}.
-	host, _, err := net.SplitHostPort(remoteAddr)
+// constructLocation loads time zone, nil location is returned for empty name.
+func constructLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(timezone)
 	if err != nil {
-		log.Warn("Unable to split host from port, using whole remote address.", "addr", remoteAddr, "err", err)
-		return fmt.Sprintf("%s@%s", name, remoteAddr)
+		return nil, errors.Errorf("unknown timezone: %s", timezone)
+	}
+	return loc, nil
+}
+
+// constructIntervalRules parses interval rules of the signal.
+func constructIntervalRules(jsonRules []IntervalRule) ([]nanny.IntervalRule, error) {
+	var rules []nanny.IntervalRule
+	for i, jsonRule := range jsonRules {
+		weekdays, holidays, err := nanny.ParseDays(jsonRule.Days)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid interval rule %d", i)
+		}
+		from, err := constructClock(jsonRule.From)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid interval rule %d", i)
+		}
+		to, err := constructClock(jsonRule.To)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid interval rule %d", i)
+		}
+		nextSignal, err := constructDuration(jsonRule.NextSignal)
+		if err != nil || nextSignal <= 0 {
+			return nil, errors.Errorf("invalid interval rule %d: invalid next_signal: %s", i, jsonRule.NextSignal)
+		}
+		rules = append(rules, nanny.IntervalRule{
+			Weekdays:   weekdays,
+			Holidays:   holidays,
+			From:       from,
+			To:         to,
+			NextSignal: nextSignal,
+		})
+	}
+	return rules, nil
+}
+
+// constructClock parses time of day "15:04" as duration since midnight, empty
+// time is midnight.
+func constructClock(clock string) (time.Duration, error) {
+	if clock == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, errors.Errorf("invalid time of day: %s", clock)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// constructHolidays looks up holiday calendar by its name, nil calendar is
+// returned for empty name.
+func constructHolidays(name string, calendars map[string]*calendar.Calendar) (*calendar.Calendar, error) {
+	if name == "" {
+		return nil, nil
+	}
+	holidays, ok := calendars[name]
+	if !ok {
+		return nil, errors.Errorf("unable to find holiday calendar: %s", name)
+	}
+	return holidays, nil
+}
+
+// constructAssertions parses assertions of reported values.
+func constructAssertions(exprs []string) ([]nanny.Assertion, error) {
+	var assertions []nanny.Assertion
+	for _, expr := range exprs {
+		a, err := nanny.ParseAssertion(expr)
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, a)
+	}
+	return assertions, nil
+}
+
+// constructEscalation looks up notifiers for given escalation steps.
+func constructEscalation(jsonSteps []EscalationStep, notifiers notifiers) ([]nanny.EscalationStep, error) {
+	var steps []nanny.EscalationStep
+	for _, step := range jsonSteps {
+		notif, ok := notifiers[step.Notifier]
+		if !ok {
+			return nil, errors.Errorf("unable to find escalation notifier: %s", step.Notifier)
+		}
+		var d durations
+		steps = append(steps, nanny.EscalationStep{
+			After:    d.parse("escalation after", step.After),
+			Notifier: notif,
+			Repeat:   d.parse("escalation repeat", step.Repeat),
+		})
+		if d.err != nil {
+			return nil, d.err
+		}
 	}
+	return steps, nil
+}
 
-	return fmt.Sprintf("%s@%s", name, host)
+// constructDuration parses duration like "10s" or "1h", integer number of
+// seconds, or ISO 8601 duration like "PT15M". Empty string means zero duration.
+func constructDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err == nil {
+		return d, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err = parseISODuration(value)
+	if err == nil {
+		return d, nil
+	}
+	return 0, errors.Errorf("%s, use duration like 15m, number of seconds or ISO 8601 duration like PT15M", value)
 }
 
-func constructDuration(nextSignal string) time.Duration {
-	d, err := time.ParseDuration(nextSignal)
+// isoDuration matches ISO 8601 duration with weeks, days, hours, minutes and
+// seconds. Years and months are not supported, their length varies.
+var isoDuration = regexp.MustCompile(`^P(?:(\d+(?:[.,]\d+)?)W)?(?:(\d+(?:[.,]\d+)?)D)?(?:T(?:(\d+(?:[.,]\d+)?)H)?(?:(\d+(?:[.,]\d+)?)M)?(?:(\d+(?:[.,]\d+)?)S)?)?$`)
+
+// parseISODuration parses ISO 8601 duration like "PT15M" or "P1DT12H".
+func parseISODuration(value string) (time.Duration, error) {
+	match := isoDuration.FindStringSubmatch(strings.ToUpper(value))
+	if match == nil || value == "P" || strings.HasSuffix(strings.ToUpper(value), "T") {
+		return 0, errors.Errorf("invalid ISO 8601 duration: %s", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.Replace(match[i+1], ",", ".", 1), 64)
+		if err != nil {
+			return 0, errors.Errorf("invalid ISO 8601 duration: %s", value)
+		}
+		d += time.Duration(n * float64(unit))
+	}
+	return d, nil
+}
+
+// constructNextSignal parses when to expect the next signal, either a duration,
+// see constructDuration, or RFC3339 time in the future. The time is returned as
+// the deadline, duration until it is used once the deadline passes. Duration
+// must be positive, empty one means next_signal is not set.
+func constructNextSignal(value string, now time.Time) (time.Duration, time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
 	if err != nil {
-		seconds, err := strconv.Atoi(nextSignal)
+		d, err := constructDuration(value)
 		if err != nil {
-			// nextSignal string can't be converted to int, it is nonsense.
-			// When we set it to 0, which will cause invalid signal and return
-			// error to the user.
-			return time.Duration(0)
+			return 0, time.Time{}, errors.Wrap(err, "invalid next_signal")
+		}
+		if value != "" && d <= 0 {
+			return 0, time.Time{}, errors.Errorf("next_signal must be positive: %s", value)
 		}
-		d = time.Duration(seconds) * time.Second
+		return d, time.Time{}, nil
 	}
+	if !t.After(now) {
+		return 0, time.Time{}, errors.Errorf("next_signal must be in the future: %s", value)
+	}
+	return t.Sub(now), t, nil
+}
 
+// durations parses durations of more fields, keeping the first error.
+type durations struct {
+	err error
+}
+
+// parse parses duration of given field, see constructDuration.
+func (p *durations) parse(field, value string) time.Duration {
+	d, err := constructDuration(value)
+	if err != nil && p.err == nil {
+		p.err = errors.Wrapf(err, "invalid %s", field)
+	}
 	return d
 }
 
+// constructUntil parses acknowledgement expiry, which may be RFC3339 time or
+// duration from now. Empty string means no expiry.
+func constructUntil(until string, now time.Time) (time.Time, error) {
+	if until == "" {
+		return time.Time{}, nil
+	}
+	t, err := constructTime(until, now)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "invalid until")
+	}
+	if !t.After(now) {
+		return time.Time{}, errors.Errorf("until must be in the future: %s", until)
+	}
+	return t, nil
+}
+
+// constructTime parses RFC3339 time or duration counted from base.
+func constructTime(value string, base time.Time) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, errors.Errorf("%s, use RFC3339 time or duration like 2h", value)
+	}
+	return base.Add(d), nil
+}
+
 func saveRoutes(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 	path, err := route.GetPathTemplate()
 	if err != nil {
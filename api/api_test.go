@@ -1,15 +1,18 @@
 package api
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"nanny/pkg/calendar"
 	"nanny/pkg/nanny"
 	"nanny/pkg/notifier"
 	"nanny/pkg/storage"
@@ -61,6 +64,17 @@ func (s *testStorage) Save(storage.Signal) error       { return nil }
 func (s *testStorage) Remove(storage.Signal) error     { return nil }
 func (s *testStorage) Close() error                    { return nil }
 
+func (s *testStorage) LoadSilences() ([]storage.Silence, error) { return nil, nil }
+func (s *testStorage) SaveSilence(storage.Silence) error        { return nil }
+func (s *testStorage) RemoveSilence(storage.Silence) error      { return nil }
+
+func (s *testStorage) LoadGroups() ([]storage.Group, error) { return nil, nil }
+func (s *testStorage) SaveGroup(storage.Group) error        { return nil }
+func (s *testStorage) RemoveGroup(storage.Group) error      { return nil }
+
+func (s *testStorage) LoadRuns(string, int) ([]storage.Run, error) { return nil, nil }
+func (s *testStorage) SaveRun(storage.Run, int) error              { return nil }
+
 var dummy = DummyNotifier{}
 var testNotifiers = notifiers{"dummy": &dummy}
 
@@ -76,7 +90,7 @@ func storageSetup(t *testing.T) storage.Storage {
 
 func routerSetup(t *testing.T) http.Handler {
 	t.Helper()
-	return router(nannySetup(t), testNotifiers, storageSetup(t))
+	return router(nannySetup(t), testNotifiers, storageSetup(t), nil, nil)
 }
 
 func serverSetup(t *testing.T) *httptest.Server {
@@ -94,8 +108,21 @@ func TestListEndpoints(t *testing.T) {
 		"/api":"",
 		"/api/":"List all available API endpoints.",
 		"/api/v1":"",
+		"/api/v1/groups":"Show all groups.",
+		"/api/v1/groups/{name}":"Show group.",
 		"/api/v1/signal":"Register new signal.",
+		"/api/v1/signal/{name}":"Remove registered signal.",
+		"/api/v1/signal/{name}/ack":"Acknowledge alerting signal.",
+		"/api/v1/signal/{name}/fail":"Report failure of registered signal.",
+		"/api/v1/signal/{name}/finish":"Finish run of registered signal.",
+		"/api/v1/signal/{name}/interval":"Override learned interval of registered signal.",
+		"/api/v1/signal/{name}/pause":"Pause registered signal.",
+		"/api/v1/signal/{name}/resume":"Resume paused signal.",
+		"/api/v1/signal/{name}/start":"Start run of registered signal.",
+		"/api/v1/signal/{name}/stats":"Show run statistics of registered signal.",
 		"/api/v1/signals":"Show all registered signals.",
+		"/api/v1/silences":"Show all silences.",
+		"/api/v1/silences/{id}":"Show silence.",
 		"/api/version":"Nanny version."
 	}`
 	assert.JSONEq(t, expected, got)
@@ -121,6 +148,45 @@ func TestAPINoNotifier(t *testing.T) {
 	assert.JSONEq(t, expected, string(body))
 }
 
+// TestAPINotifierList tests that "notifier" can be a list of notifiers.
+func TestAPINotifierList(t *testing.T) {
+	ts := serverSetup(t)
+	defer ts.Close()
+
+	payload := `{ "name": "my awesome program", "notifier": ["dummy", "N/A"], "next_signal": "5s" }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	resp.Body.Close()
+	assert.Equal(t, 400, resp.StatusCode)
+
+	payload = `{ "name": "my awesome program", "notifier": ["dummy", "dummy"], "next_signal": "5s" }`
+	resp, err = http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+// TestAPINoEscalationNotifier tests that unknown escalation notifier is rejected.
+func TestAPINoEscalationNotifier(t *testing.T) {
+	ts := serverSetup(t)
+	defer ts.Close()
+
+	payload := `{ "name": "my awesome program", "notifier": "dummy", "next_signal": "5s", "escalation": [{"after": "15m", "notifier": "N/A"}] }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, 400, resp.StatusCode)
+	expected := `{"status_code":400, "error":"unable to find escalation notifier: N/A"}`
+	assert.JSONEq(t, expected, string(body))
+}
+
 // TestAPISignal tests correct error emit when API isn't called within specified
 // time.
 func TestAPISignal(t *testing.T) {
@@ -170,6 +236,268 @@ func TestAPISignalAcceptsInt(t *testing.T) {
 	assert.Contains(t, msg.Format(), `Nanny: I did not hear from "my awesome program@127.0.0.1" in 1s!`)
 }
 
+// TestAPIDeleteSignal tests that registered signal can be removed and does not
+// notify afterwards.
+func TestAPIDeleteSignal(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	payload := `{ "name": "my deleted program", "notifier": "dummy", "next_signal": "1s" }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.NotNil(t, n.GetTimer("my deleted program@127.0.0.1"))
+
+	req, err := http.NewRequest("DELETE", ts.URL+"/api/v1/signal/my deleted program@127.0.0.1", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Nil(t, n.GetTimer("my deleted program@127.0.0.1"))
+
+	// Second delete should not find the signal.
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, "", notif.NotifyMsg().Program)
+}
+
+// TestAPISignalsFilter tests filtering of signals listing by state.
+func TestAPISignalsFilter(t *testing.T) {
+	n := nannySetup(t)
+	ts := httptest.NewServer(router(n, testNotifiers, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	for _, name := range []string{"first", "second"} {
+		payload := `{ "name": "` + name + `", "notifier": "dummy", "next_signal": "1h" }`
+		resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	resp, err := http.Post(ts.URL+"/api/v1/signal/second@127.0.0.1/pause", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{"state": []string{"paused"}})
+	assert.Contains(t, got, `"name":"second@127.0.0.1"`)
+	assert.NotContains(t, got, `"name":"first@127.0.0.1"`)
+	assert.Contains(t, got, `"state":"paused"`)
+
+	got = assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{"state": []string{"waiting,paused"}})
+	assert.Contains(t, got, `"name":"first@127.0.0.1"`)
+	assert.Contains(t, got, `"name":"second@127.0.0.1"`)
+
+	assert.HTTPError(t, ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{"state": []string{"unknown"}})
+}
+
+// TestAPIAckSignal tests acknowledging of alerting signal.
+func TestAPIAckSignal(t *testing.T) {
+	n := nannySetup(t)
+	ts := httptest.NewServer(router(n, notifiers{"dummy": &DummyNotifier{}}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/v1/signal/unknown/ack", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+
+	payload := `{ "name": "my acked program", "notifier": "dummy", "next_signal": "100ms" }`
+	resp, err = http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// Signal is not alerting yet.
+	ack := `{ "who": "admin", "note": "looking into it", "until": "1h" }`
+	resp, err = http.Post(ts.URL+"/api/v1/signal/my acked program@127.0.0.1/ack", "application/json", strings.NewReader(ack))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 409, resp.StatusCode)
+
+	time.Sleep(200 * time.Millisecond)
+	resp, err = http.Post(ts.URL+"/api/v1/signal/my acked program@127.0.0.1/ack", "application/json", strings.NewReader(`{ "until": "nonsense" }`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 400, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL+"/api/v1/signal/my acked program@127.0.0.1/ack", "application/json", strings.NewReader(ack))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"by":"admin"`)
+	assert.Contains(t, got, `"note":"looking into it"`)
+	assert.Contains(t, got, `"until":`)
+}
+
+// TestAPISilences tests silences CRUD and that silenced signal does not notify.
+func TestAPISilences(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	payload := `{ "matchers": [{"value": "[invalid"}], "end": "1h" }`
+	resp, err := http.Post(ts.URL+"/api/v1/silences", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 400, resp.StatusCode)
+
+	payload = `{ "matchers": [{"value": "backup-*"}, {"meta": "env", "value": "prod|stage", "regex": true}], "end": "1h", "created_by": "admin", "comment": "maintenance" }`
+	resp, err = http.Post(ts.URL+"/api/v1/silences", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	var created struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	require.NotEmpty(t, created.ID)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/silences", url.Values{})
+	assert.Contains(t, got, `"id":"`+created.ID+`"`)
+	assert.Contains(t, got, `"active":true`)
+
+	payload = `{ "name": "backup-db", "notifier": "dummy", "next_signal": "100ms", "meta": {"env": "prod"} }`
+	resp, err = http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, "", notif.NotifyMsg().Program)
+	got = assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"silences":{"silenced":true`)
+
+	// Removing the silence sends the suppressed notification.
+	req, err := http.NewRequest("DELETE", ts.URL+"/api/v1/silences/"+created.ID, nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "backup-db@127.0.0.1", notif.NotifyMsg().Program)
+
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+// TestAPIScheduledSignal tests registering signal with cron schedule.
+func TestAPIScheduledSignal(t *testing.T) {
+	ts := serverSetup(t)
+	defer ts.Close()
+
+	payload := `{ "name": "my nightly backup", "notifier": "dummy", "schedule": "0 2 * * *", "timezone": "Europe/Prague", "tolerance": "1h30m" }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"rules":{"schedule":"0 2 * * *","timezone":"Europe/Prague","tolerance":"1h30m0s"}`)
+
+	for _, payload := range []string{
+		`{ "name": "my nightly backup", "notifier": "dummy", "schedule": "0 25 * * *" }`,
+		`{ "name": "my nightly backup", "notifier": "dummy", "schedule": "0 2 * * *", "timezone": "Mars/Olympus" }`,
+	} {
+		resp, err = http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 400, resp.StatusCode)
+	}
+}
+
+// TestAPIRun tests starting and finishing runs of a signal.
+func TestAPIRun(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	payload := `{ "name": "my batch job", "notifier": "dummy", "next_signal": "1h" }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// There is no default max_runtime.
+	resp, err = http.Post(ts.URL+"/api/v1/signal/my batch job@127.0.0.1/start", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 400, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL+"/api/v1/signal/my batch job@127.0.0.1/finish", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 409, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL+"/api/v1/signal/my batch job@127.0.0.1/start", "application/json", strings.NewReader(`{ "max_runtime": "100ms" }`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"runs":{"run_started":`)
+
+	time.Sleep(200 * time.Millisecond)
+	msg := notif.NotifyMsg()
+	assert.Contains(t, msg.Format(), `"my batch job@127.0.0.1" started, but did not finish in 100ms!`)
+
+	resp, err = http.Post(ts.URL+"/api/v1/signal/my batch job@127.0.0.1/finish", "application/json", nil)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, string(body), `"runtime":`)
+
+	got = assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"last_runtime":`)
+	assert.Contains(t, got, `"state":"recovered"`)
+}
+
+// TestAPIFailSignal tests that reported failure notifies immediately.
+func TestAPIFailSignal(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	failure := `{ "exit_code": 3, "log": "connection refused" }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal/my failing program@127.0.0.1/fail", "application/json", strings.NewReader(failure))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+
+	payload := `{ "name": "my failing program", "notifier": "dummy", "next_signal": "1h" }`
+	resp, err = http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = http.Post(ts.URL+"/api/v1/signal/my failing program@127.0.0.1/fail", "application/json", strings.NewReader(failure))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	msg := notif.NotifyMsg()
+	assert.Equal(t, notifier.KindFailure, msg.Kind)
+	assert.Contains(t, msg.Format(), `"my failing program@127.0.0.1" failed with exit code 3!`)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"state":"alerting"`)
+	assert.Contains(t, got, `"alert":"failure"`)
+	assert.Contains(t, got, `"exit_code":3,"log":"connection refused"}`)
+}
+
 // TODO
 func TestPersistence(t *testing.T) {}
 
@@ -178,7 +506,8 @@ func TestConstructName(t *testing.T) {
 	r, _ := http.NewRequest("POST", "/ignored/anyway", nil)
 	r.RemoteAddr = "10.11.12.13:8089"
 
-	assert.Equal(t, constructName(signalName, r), "test_name@10.11.12.13")
+	name, _ := (&Identity{}).constructName(signalName, r, nil)
+	assert.Equal(t, name, "test_name@10.11.12.13")
 }
 
 func TestConstructNameXForwardedForHeader(t *testing.T) {
@@ -187,7 +516,14 @@ func TestConstructNameXForwardedForHeader(t *testing.T) {
 	r.RemoteAddr = "10.11.12.13:8089"
 	r.Header.Add("X-Forwarded-For", "14.15.16.17")
 
-	assert.Equal(t, constructName(signalName, r), "test_name_x_forwarded_for@14.15.16.17")
+	// Any caller could send the header, it is ignored without trusted proxies.
+	name, _ := (&Identity{}).constructName(signalName, r, nil)
+	assert.Equal(t, name, "test_name_x_forwarded_for@10.11.12.13")
+
+	identity, err := newIdentity(Identity{TrustedProxies: []string{"10.11.12.13"}})
+	require.NoError(t, err)
+	name, _ = identity.constructName(signalName, r, nil)
+	assert.Equal(t, name, "test_name_x_forwarded_for@14.15.16.17")
 }
 func TestConstructNameXDontModifyNameHeader(t *testing.T) {
 	signalName := "test_name_x_dont_modify_name"
@@ -196,5 +532,709 @@ func TestConstructNameXDontModifyNameHeader(t *testing.T) {
 	r.Header.Add("X-Forwarded-For", "14.15.16.17")
 	r.Header.Add("X-Dont-Modify-Name", "true")
 
-	assert.Equal(t, constructName(signalName, r), "test_name_x_dont_modify_name")
+	name, _ := (&Identity{}).constructName(signalName, r, nil)
+	assert.Equal(t, name, "test_name_x_dont_modify_name")
+}
+
+func TestConstructNameIdentityHeader(t *testing.T) {
+	signalName := "test_name_identity_header"
+	r, _ := http.NewRequest("POST", "/ignored/anyway", nil)
+	r.RemoteAddr = "10.11.12.13:8089"
+	r.Header.Add("X-Client-Name", "web-1")
+
+	// Any caller could send the header, it is ignored without trusted proxies.
+	identity, err := newIdentity(Identity{Header: "X-Client-Name"})
+	require.NoError(t, err)
+	name, _ := identity.constructName(signalName, r, nil)
+	assert.Equal(t, name, "test_name_identity_header@10.11.12.13")
+
+	identity, err = newIdentity(Identity{TrustedProxies: []string{"10.11.12.13"}, Header: "X-Client-Name"})
+	require.NoError(t, err)
+	name, _ = identity.constructName(signalName, r, nil)
+	assert.Equal(t, name, "test_name_identity_header@web-1")
+}
+
+// TestIdentity tests resolving identity of callers behind proxies.
+func TestIdentity(t *testing.T) {
+	trusted, err := newIdentity(Identity{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"}, Header: "X-Client-Name", MetaHost: "host"})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		identity *Identity
+		remote   string
+		headers  map[string]string
+		meta     map[string]string
+		expected string
+	}{
+		{nil, "10.0.0.1:8089", map[string]string{"X-Forwarded-For": "14.15.16.17, 10.0.0.2"}, nil, "10.0.0.1"},
+		{nil, "10.0.0.1:8089", map[string]string{"Forwarded": "for=14.15.16.17"}, nil, "10.0.0.1"},
+		{trusted, "10.0.0.1:8089", map[string]string{"X-Forwarded-For": "6.6.6.6, 14.15.16.17, 10.0.0.2"}, nil, "14.15.16.17"},
+		{trusted, "192.168.1.1:8089", map[string]string{"X-Forwarded-For": "14.15.16.17:1234"}, nil, "14.15.16.17"},
+		{trusted, "14.15.16.17:8089", map[string]string{"X-Forwarded-For": "6.6.6.6"}, nil, "14.15.16.17"},
+		{trusted, "10.0.0.1:8089", map[string]string{"Forwarded": `for=6.6.6.6, For="[2001:db8::1]:4711";proto=https`}, nil, "2001:db8::1"},
+		{trusted, "10.0.0.1:8089", map[string]string{"Forwarded": "for=6.6.6.6, for=_hidden"}, nil, "10.0.0.1"},
+		{trusted, "10.0.0.1:8089", map[string]string{"X-Client-Name": "web-1"}, nil, "web-1"},
+		{trusted, "14.15.16.17:8089", map[string]string{"X-Client-Name": "web-1"}, nil, "14.15.16.17"},
+		{trusted, "14.15.16.17:8089", nil, map[string]string{"host": "db-1"}, "db-1"},
+	} {
+		r, _ := http.NewRequest("POST", "/ignored/anyway", nil)
+		r.RemoteAddr = tc.remote
+		for key, value := range tc.headers {
+			r.Header.Add(key, value)
+		}
+		name, identity := tc.identity.constructName("test", r, tc.meta)
+		assert.Equal(t, tc.expected, identity, tc.headers)
+		assert.Equal(t, "test@"+tc.expected, name, tc.headers)
+	}
+
+	_, err = newIdentity(Identity{TrustedProxies: []string{"proxy"}})
+	assert.Error(t, err)
+	_, err = newIdentity(Identity{TrustedProxies: []string{"10.0.0.0/33"}})
+	assert.Error(t, err)
+}
+
+// TestIdentityReverseDNS tests hostnames found by reverse DNS are cached and
+// callers do not wait for the lookup.
+func TestIdentityReverseDNS(t *testing.T) {
+	identity, err := newIdentity(Identity{ReverseDNS: true})
+	require.NoError(t, err)
+	identity.hosts.hosts["14.15.16.17"] = cachedHost{name: "db-1", expires: time.Now().Add(time.Minute)}
+	// Expired hostname is used until it is looked up again.
+	identity.hosts.hosts["192.0.2.2"] = cachedHost{name: "db-2", expires: time.Now().Add(-time.Minute), pending: true}
+
+	for remote, expected := range map[string]string{
+		"14.15.16.17:8089": "db-1",
+		"192.0.2.2:8089":   "db-2",
+		"192.0.2.1:8089":   "192.0.2.1",
+	} {
+		r, _ := http.NewRequest("POST", "/ignored/anyway", nil)
+		r.RemoteAddr = remote
+		started := time.Now()
+		name, caller := identity.constructName("test", r, nil)
+		assert.Less(t, int64(time.Since(started)), int64(lookupTimeout), remote)
+		assert.Equal(t, expected, caller, remote)
+		assert.Equal(t, "test@"+expected, name, remote)
+	}
+	identity.hosts.lock.Lock()
+	_, ok := identity.hosts.hosts["192.0.2.1"]
+	identity.hosts.lock.Unlock()
+	assert.True(t, ok, "hostname of new address should be looked up")
+}
+
+// TestAPIIdentity tests identity of the caller is recorded with the signal.
+func TestAPIIdentity(t *testing.T) {
+	n := nannySetup(t)
+	ts := httptest.NewServer(router(n, testNotifiers, storageSetup(t), nil, &Identity{MetaHost: "host"}))
+	defer ts.Close()
+
+	req, err := http.NewRequest("POST", ts.URL+"/api/v1/signal", strings.NewReader(`{ "name": "backup", "notifier": "dummy", "next_signal": "1h", "meta": {"host": "db-1"} }`))
+	require.NoError(t, err)
+	req.Header.Add("X-Dont-Modify-Name", "true")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+
+	timer := n.GetTimer("backup")
+	require.NotNil(t, timer)
+	assert.Equal(t, "db-1", timer.Signal().Identity)
+	data, err := json.Marshal(timer)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"identity":"db-1"`)
+}
+
+// TestAPIDependencies tests registering signals depending on other signals.
+func TestAPIDependencies(t *testing.T) {
+	ts := serverSetup(t)
+	defer ts.Close()
+
+	for _, payload := range []string{
+		`{ "name": "broker", "notifier": "dummy", "next_signal": "1h" }`,
+		`{ "name": "consumer", "notifier": "dummy", "next_signal": "1h", "depends_on": ["broker@127.0.0.1"] }`,
+	} {
+		resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"depends_on":["broker@127.0.0.1"]`)
+
+	payload := `{ "name": "broker", "notifier": "dummy", "next_signal": "1h", "depends_on": ["consumer@127.0.0.1"] }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.NotEqual(t, 200, resp.StatusCode)
+}
+
+// TestAPIGroups tests creating, showing and removing quorum groups.
+func TestAPIGroups(t *testing.T) {
+	ts := serverSetup(t)
+	defer ts.Close()
+
+	for _, payload := range []string{
+		`{ "name": "worker", "notifier": "dummy", "next_signal": "1h" }`,
+		`{ "name": "worker", "notifier": "dummy", "next_signal": "1h", "meta": {"role": "worker"} }`,
+	} {
+		resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	for _, payload := range []string{
+		`{ "name": "workers", "prefix": "worker@", "notifier": "dummy" }`,
+		`{ "name": "workers", "min_alive": 1, "notifier": "dummy" }`,
+		`{ "name": "workers", "prefix": "worker@", "min_alive": 1, "notifier": "N/A" }`,
+	} {
+		resp, err := http.Post(ts.URL+"/api/v1/groups", "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 400, resp.StatusCode)
+	}
+
+	payload := `{ "name": "workers", "prefix": "worker@", "meta": {"role": "worker"}, "min_alive": 1, "notifier": "dummy" }`
+	resp, err := http.Post(ts.URL+"/api/v1/groups", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/groups", url.Values{})
+	assert.Contains(t, got, `"name":"workers"`)
+	assert.Contains(t, got, `"state":"waiting","alive":1,"members":1`)
+	got = assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"group":"workers"`)
+	assert.HTTPBodyContains(t, ts.Config.Handler.ServeHTTP, "GET", "/api/v1/groups/workers", url.Values{}, `"min_alive":1`)
+
+	req, err := http.NewRequest("DELETE", ts.URL+"/api/v1/groups/workers", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/api/v1/groups/workers")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+// TestAPIFlapping tests registering signal with flap detection and all-clear
+// hysteresis.
+func TestAPIFlapping(t *testing.T) {
+	ts := serverSetup(t)
+	defer ts.Close()
+
+	payload := `{ "name": "flaky program", "notifier": "dummy", "next_signal": "1h", "all_clear": true,
+		"flap_window": "1h", "flap_threshold": 4, "stable_pings": 3, "stable_for": "10m" }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"silences":{"flap_window":"1h0m0s","flap_threshold":4`)
+	assert.Contains(t, got, `"stable_pings":3,"stable_for":"10m0s"`)
+
+	payload = `{ "name": "flaky program", "notifier": "dummy", "next_signal": "1h", "flap_threshold": 4 }`
+	resp, err = http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.NotEqual(t, 200, resp.StatusCode)
+}
+
+// TestAPITooFrequent tests that program calling more often than its maximum rate
+// is notified.
+func TestAPITooFrequent(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	payload := `{ "name": "crashing job", "notifier": "dummy", "next_signal": "1h", "min_interval": "30m", "max_rate": 2, "rate_window": "1h" }`
+	for i := 0; i < 3; i++ {
+		resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+	msg := notif.NotifyMsg()
+	assert.Equal(t, notifier.KindFrequent, msg.Kind)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"checks":{"min_interval":"30m0s","max_rate":2,"rate_window":"1h0m0s","early":true,"frequent":true`)
+}
+
+func TestAPIInverse(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	payload := `{ "name": "never", "notifier": "dummy", "inverse": true, "cooldown": "1h" }`
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+	msg := notif.NotifyMsg()
+	assert.Equal(t, notifier.KindTripped, msg.Kind)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"type":"inverse"`)
+	assert.Contains(t, got, `"checks":{"cooldown":"1h0m0s"}`)
+	assert.Contains(t, got, `"state":"alerting"`)
+}
+
+func TestAPIThroughput(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	payloads := []string{
+		`{ "name": "stream", "notifier": "dummy", "min_throughput": 100, "throughput_window": "10m", "count": 60 }`,
+		`{ "name": "stream", "notifier": "dummy", "min_throughput": 100, "throughput_window": "10m" }`,
+	}
+	for _, payload := range payloads {
+		resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"type":"throughput"`)
+	assert.Contains(t, got, `"checks":{"min_throughput":100,"throughput_window":"10m0s","throughput":61}`)
+}
+
+func TestAPIAssertions(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	payload := `{ "name": "etl", "notifier": "dummy", "next_signal": "1h", "assertions": ["records > 0", "errors < 5"], "values": {"records": 0, "errors": 0} }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	msg := notif.NotifyMsg()
+	assert.Equal(t, notifier.KindAssertion, msg.Kind)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	// Encoded JSON escapes < and >.
+	assert.Contains(t, got, `"checks":{"assertions":["records \u003e 0","errors \u003c 5"],"values":{"errors":0,"records":0}`)
+	assert.Contains(t, got, `"failed_assertion":"records = 0, expected records \u003e 0"`)
+
+	payload = `{ "name": "etl", "notifier": "dummy", "next_signal": "1h", "assertions": ["records >"] }`
+	resp, err = http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestAPIStalled(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	payload := `{ "name": "migration", "notifier": "dummy", "next_signal": "1m", "stall_after": "30m", "progress": 42.5 }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"checks":{"stall_after":"30m0s","progress":42.5,"progressed_at":`)
+}
+
+func TestAPIRunStats(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	payload := `{ "name": "backup", "notifier": "dummy", "next_signal": "1h", "runtime_factor": 3 }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signal/backup@127.0.0.1/stats", url.Values{})
+	assert.JSONEq(t, `{"runs":0}`, got)
+
+	// Maximum runtime is optional with anomaly detection.
+	resp, err = http.Post(ts.URL+"/api/v1/signal/backup@127.0.0.1/start", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	resp, err = http.Post(ts.URL+"/api/v1/signal/backup@127.0.0.1/finish", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got = assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signal/backup@127.0.0.1/stats", url.Values{})
+	assert.Contains(t, got, `"runs":1,"last":`)
+	assert.Contains(t, got, `"p95":`)
+	assert.NotContains(t, got, `"anomaly_after"`)
+
+	assert.HTTPError(t, ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signal/unknown/stats", url.Values{})
+}
+
+func TestAPILearn(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	payload := `{ "name": "cleanup", "notifier": "dummy", "learn_pings": 5 }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"learning":{"learn_pings":5,"learning":true}`)
+
+	payload = `{ "interval": "1h", "grace": "10m" }`
+	resp, err = http.Post(ts.URL+"/api/v1/signal/cleanup@127.0.0.1/interval", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got = assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"learning":{"learn_pings":5,"learned_interval":"1h0m0s","learned_grace":"10m0s"}`)
+
+	// Signal with explicit interval does not learn it.
+	payload = `{ "name": "backup", "notifier": "dummy", "next_signal": "1h" }`
+	resp, err = http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = http.Post(ts.URL+"/api/v1/signal/backup@127.0.0.1/interval", "application/json", strings.NewReader(`{ "interval": "2h" }`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 409, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL+"/api/v1/signal/unknown/interval", "application/json", strings.NewReader(`{ "interval": "2h" }`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestAPIIntervalRules(t *testing.T) {
+	n := nannySetup(t)
+	holidays, err := calendar.Parse("czech", strings.NewReader("BEGIN:VCALENDAR\nEND:VCALENDAR\n"))
+	require.NoError(t, err)
+	n.Calendars = map[string]*calendar.Calendar{"czech": holidays}
+	notif := &DummyNotifier{}
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif}, storageSetup(t), nil, nil))
+	defer ts.Close()
+
+	payload := `{ "name": "etl", "notifier": "dummy", "next_signal": "1h", "timezone": "UTC", "holidays": "czech",
+		"interval_rules": [{"days": ["mon-fri"], "from": "08:00", "to": "18:00", "next_signal": "5m"}, {"days": ["sat", "sun", "holiday"], "next_signal": "2h"}] }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"rules":{"timezone":"UTC","interval_rules":[{"days":["mon","tue","wed","thu","fri"],"from":"08:00","to":"18:00","next_signal":"5m0s"},{"days":["sat","sun","holiday"],"next_signal":"2h0m0s"}],"holidays":"czech"`)
+
+	// Range of days wraps around the end of week.
+	payload = `{ "name": "weekend", "notifier": "dummy", "next_signal": "1h", "interval_rules": [{"days": ["fri-mon"], "next_signal": "2h"}] }`
+	resp, err = http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	got = assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"rules":{"timezone":"UTC","interval_rules":[{"days":["fri","sat","sun","mon"],"next_signal":"2h0m0s"}]}`)
+
+	for _, payload := range []string{
+		`{ "name": "etl", "notifier": "dummy", "next_signal": "1h", "interval_rules": [{"days": ["fri-monday"], "next_signal": "5m"}] }`,
+		`{ "name": "etl", "notifier": "dummy", "next_signal": "1h", "interval_rules": [{"from": "8am", "next_signal": "5m"}] }`,
+		`{ "name": "etl", "notifier": "dummy", "next_signal": "1h", "interval_rules": [{"next_signal": "soon"}] }`,
+		`{ "name": "etl", "notifier": "dummy", "next_signal": "1h", "interval_rules": [{"next_signal": "5m"}], "holidays": "unknown" }`,
+	} {
+		resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 400, resp.StatusCode, payload)
+	}
+}
+
+func TestConstructDuration(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"":         0,
+		"90s":      time.Duration(90) * time.Second,
+		"1h30m":    time.Duration(90) * time.Minute,
+		"120":      time.Duration(2) * time.Minute,
+		"PT15M":    time.Duration(15) * time.Minute,
+		"PT1H30M":  time.Duration(90) * time.Minute,
+		"P1DT12H":  time.Duration(36) * time.Hour,
+		"P1W":      time.Duration(7*24) * time.Hour,
+		"PT0,5S":   time.Duration(500) * time.Millisecond,
+		"pt2h":     time.Duration(2) * time.Hour,
+		"PT1.5H":   time.Duration(90) * time.Minute,
+		"P2D":      time.Duration(48) * time.Hour,
+		"PT10M30S": time.Duration(630) * time.Second,
+	} {
+		d, err := constructDuration(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, d, value)
+	}
+	for _, value := range []string{"soon", "P", "PT", "P1Y", "P1M", "PT15", "15M", "1.5"} {
+		_, err := constructDuration(value)
+		assert.Error(t, err, value)
+	}
+}
+
+// TestAPINextSignalDeadline tests that time of the next signal does not move when
+// the signal is reset without a call, or restored.
+func TestAPINextSignalDeadline(t *testing.T) {
+	store, err := storage.NewSQLiteDB(filepath.Join(t.TempDir(), "nanny.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	n := nannySetup(t)
+	ts := httptest.NewServer(router(n, testNotifiers, store, nil, nil))
+	defer ts.Close()
+
+	deadline := time.Now().Add(time.Duration(2) * time.Hour).Truncate(time.Second)
+	payload := `{ "name": "deadline", "notifier": "dummy", "next_signal": "` + deadline.UTC().Format(time.RFC3339) + `" }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL+"/api/v1/signal/deadline@127.0.0.1/start", "application/json", strings.NewReader(`{ "max_runtime": "1h" }`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	time.Sleep(50 * time.Millisecond)
+	resp, err = http.Post(ts.URL+"/api/v1/signal/deadline@127.0.0.1/finish", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+
+	timer := n.GetTimer("deadline@127.0.0.1")
+	require.NotNil(t, timer)
+	assert.True(t, deadline.Equal(timer.Status().NextSignal), timer.Status().NextSignal)
+
+	restored := nannySetup(t)
+	loadStorage(restored, testNotifiers, store, nil)
+	timer = restored.GetTimer("deadline@127.0.0.1")
+	require.NotNil(t, timer)
+	assert.True(t, deadline.Equal(timer.Signal().Deadline), timer.Signal().Deadline)
+	assert.True(t, deadline.Equal(timer.Status().NextSignal), timer.Status().NextSignal)
+}
+
+func TestAPINextSignalFormats(t *testing.T) {
+	ts := serverSetup(t)
+	defer ts.Close()
+
+	payload := `{ "name": "iso", "notifier": "dummy", "next_signal": "PT15M" }`
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	deadline := time.Now().Add(time.Duration(2) * time.Hour).Truncate(time.Second)
+	payload = `{ "name": "deadline", "notifier": "dummy", "next_signal": "` + deadline.UTC().Format(time.RFC3339) + `" }`
+	resp, err = http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	got := assert.HTTPBody(ts.Config.Handler.ServeHTTP, "GET", "/api/v1/signals", url.Values{})
+	assert.Contains(t, got, `"name":"deadline@127.0.0.1","type":"heartbeat","notifier":"dummy","next_signal":"`+deadline.Format(time.RFC3339)+`"`)
+
+	for payload, expected := range map[string]string{
+		`{ "name": "bad", "notifier": "dummy", "next_signal": "soon" }`:                                                        "invalid next_signal: soon, use duration like 15m, number of seconds or ISO 8601 duration like PT15M",
+		`{ "name": "bad", "notifier": "dummy", "next_signal": "2020-01-01T00:00:00Z" }`:                                        "next_signal must be in the future: 2020-01-01T00:00:00Z",
+		`{ "name": "bad", "notifier": "dummy", "next_signal": "-5m" }`:                                                         "next_signal must be positive: -5m",
+		`{ "name": "bad", "notifier": "dummy", "next_signal": "-300" }`:                                                        "next_signal must be positive: -300",
+		`{ "name": "bad", "notifier": "dummy", "next_signal": "PT-5M" }`:                                                       "invalid next_signal: PT-5M",
+		`{ "name": "bad", "notifier": "dummy", "next_signal": "1h", "grace": "P1M" }`:                                          "invalid grace: P1M",
+		`{ "name": "bad", "notifier": "dummy", "next_signal": "1h", "escalation": [{"after": "later", "notifier": "dummy"}] }`: "invalid escalation after: later",
+	} {
+		resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 400, resp.StatusCode, payload)
+		assert.Contains(t, string(body), expected, payload)
+	}
+}
+
+func TestAPIProfiles(t *testing.T) {
+	n := nannySetup(t)
+	notif := &DummyNotifier{}
+	profiles, err := newProfiles([]Profile{
+		{Name: "nightly-batch", Match: "backup-*", Signal: Signal{
+			Notifier:   NotifierList{"dummy"},
+			NextSignal: "24h",
+			Grace:      "1h",
+			AllClear:   true,
+			Escalation: []EscalationStep{{After: "30m", Notifier: "other"}},
+			Meta:       map[string]string{"team": "ops"},
+		}},
+		{Name: "frequent", Signal: Signal{NextSignal: "1m"}},
+	}, n, notifiers{"dummy": notif, "other": &DummyNotifier{}})
+	require.NoError(t, err)
+	ts := httptest.NewServer(router(n, notifiers{"dummy": notif, "other": &DummyNotifier{}}, storageSetup(t), profiles, nil))
+	defer ts.Close()
+
+	for _, payload := range []string{
+		`{ "name": "etl", "profile": "nightly-batch" }`,
+		`{ "name": "backup-db" }`,
+		`{ "name": "backup-web", "next_signal": "1h", "all_clear": false, "meta": {"host": "web"} }`,
+		`{ "name": "backup-mail", "profile": "frequent", "notifier": "dummy" }`,
+	} {
+		resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode, payload)
+	}
+
+	for _, name := range []string{"etl@127.0.0.1", "backup-db@127.0.0.1"} {
+		signal := n.GetTimer(name).Signal()
+		assert.Equal(t, time.Duration(24)*time.Hour, signal.NextSignal, name)
+		assert.Equal(t, time.Duration(1)*time.Hour, signal.Grace, name)
+		assert.True(t, signal.AllClear, name)
+		assert.Len(t, signal.Escalation, 1, name)
+	}
+	signal := n.GetTimer("backup-web@127.0.0.1").Signal()
+	assert.Equal(t, time.Duration(1)*time.Hour, signal.NextSignal)
+	assert.Equal(t, time.Duration(1)*time.Hour, signal.Grace)
+	assert.False(t, signal.AllClear)
+	assert.Equal(t, map[string]string{"team": "ops", "host": "web"}, signal.Meta)
+	assert.Equal(t, map[string]string{"team": "ops"}, profiles[1].Signal.Meta)
+	signal = n.GetTimer("backup-mail@127.0.0.1").Signal()
+	assert.Equal(t, time.Duration(1)*time.Minute, signal.NextSignal)
+	assert.False(t, signal.AllClear)
+
+	resp, err := http.Post(ts.URL+"/api/v1/signal", "application/json", strings.NewReader(`{ "name": "etl", "profile": "unknown" }`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 400, resp.StatusCode)
+
+	for _, p := range []Profile{
+		{Name: "invalid", Signal: Signal{Notifier: NotifierList{"N/A"}}},
+		{Name: "invalid", Match: "[", Signal: Signal{Notifier: NotifierList{"dummy"}}},
+		{Name: "invalid", Signal: Signal{Grace: "1 hour"}},
+		{Name: "invalid", Signal: Signal{NextSignal: "-1h"}},
+		{Name: "invalid", Signal: Signal{Assertions: []string{"records >"}}},
+		{Name: "invalid", Signal: Signal{Escalation: []EscalationStep{{After: "soon", Notifier: "dummy"}}}},
+	} {
+		_, err = newProfiles([]Profile{p}, n, notifiers{"dummy": notif})
+		assert.Error(t, err, p.Signal)
+	}
+}
+
+func TestAPIDeclared(t *testing.T) {
+	store, err := storage.NewSQLiteDB(filepath.Join(t.TempDir(), "nanny.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	lastSignal := time.Now().Add(-3 * time.Hour).Round(time.Second)
+	err = store.Save(storage.Signal{
+		Name:       "backup@10.0.0.5",
+		Notifier:   "dummy",
+		Interval:   time.Duration(1) * time.Hour,
+		Grace:      time.Duration(1) * time.Minute,
+		NextSignal: lastSignal.Add(time.Hour),
+		LastSignal: lastSignal,
+		State:      string(nanny.StateWaiting),
+	})
+	require.NoError(t, err)
+
+	a := Server{
+		Notifiers: notifiers{"dummy": &DummyNotifier{}},
+		Storage:   store,
+		Profiles:  []Profile{{Name: "nightly-batch", Signal: Signal{NextSignal: "24h", Grace: "1h", AllClear: true}}},
+		Signals: []Declared{
+			{Signal: json.RawMessage(`{"name": "backup@10.0.0.5", "notifier": "dummy", "next_signal": "1h", "grace": "5m"}`)},
+			{Signal: json.RawMessage(`{"name": "etl", "profile": "nightly-batch", "notifier": "dummy", "all_clear": false}`), FirstSignal: "2h"},
+			{Signal: json.RawMessage(`{"name": "report", "profile": "nightly-batch", "notifier": "dummy"}`)},
+		},
+	}
+	_, err = a.Handler()
+	require.NoError(t, err)
+
+	// Stale declared signal is restored with its state and new settings.
+	timer := a.nanny.GetTimer("backup@10.0.0.5")
+	require.NotNil(t, timer)
+	assert.True(t, lastSignal.Equal(timer.Status().LastSignal))
+	assert.Equal(t, time.Duration(5)*time.Minute, timer.Signal().Grace)
+
+	// Signal which never called expects the first signal within first_signal.
+	timer = a.nanny.GetTimer("etl")
+	require.NotNil(t, timer)
+	status := timer.Status()
+	assert.True(t, status.LastSignal.IsZero())
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), status.NextSignal, time.Minute)
+	assert.Equal(t, time.Duration(24)*time.Hour, timer.Signal().NextSignal)
+	assert.Equal(t, time.Duration(1)*time.Hour, timer.Signal().Grace)
+
+	// Explicit false overrides the profile, omitted field keeps it.
+	assert.False(t, timer.Signal().AllClear)
+	timer = a.nanny.GetTimer("report")
+	require.NotNil(t, timer)
+	assert.True(t, timer.Signal().AllClear)
+
+	signals, err := store.Load()
+	require.NoError(t, err)
+	var names []string
+	for _, signal := range signals {
+		names = append(names, signal.Name)
+		if signal.Name == "backup@10.0.0.5" {
+			assert.Equal(t, time.Duration(5)*time.Minute, signal.Grace)
+		}
+	}
+	assert.ElementsMatch(t, []string{"backup@10.0.0.5", "etl", "report"}, names)
+
+	// Signals removed from config are removed when they never called, others are
+	// no longer declared.
+	err = a.nanny.Handle(a.nanny.GetTimer("etl").Signal())
+	require.NoError(t, err)
+	saveSignal(store, a.nanny.GetTimer("etl"))
+	for _, timer := range a.nanny.GetTimers() {
+		timer.Stop()
+	}
+	restarted := Server{
+		Notifiers: notifiers{"dummy": &DummyNotifier{}},
+		Storage:   store,
+		Signals:   a.Signals[:1],
+	}
+	_, err = restarted.Handler()
+	require.NoError(t, err)
+	assert.Nil(t, restarted.nanny.GetTimer("report"))
+	timer = restarted.nanny.GetTimer("etl")
+	require.NotNil(t, timer)
+	assert.False(t, timer.Signal().Declared)
+	assert.True(t, restarted.nanny.GetTimer("backup@10.0.0.5").Signal().Declared)
+	signals, err = store.Load()
+	require.NoError(t, err)
+	names = nil
+	for _, signal := range signals {
+		names = append(names, signal.Name)
+		assert.Equal(t, signal.Name == "backup@10.0.0.5", signal.Declared, signal.Name)
+	}
+	assert.ElementsMatch(t, []string{"backup@10.0.0.5", "etl"}, names)
+
+	for _, declared := range [][]Declared{
+		{{Signal: json.RawMessage(`{"notifier": "dummy", "next_signal": "1h"}`)}},
+		{{Signal: json.RawMessage(`{"name": "etl", "notifier": "N/A", "next_signal": "1h"}`)}},
+		{{Signal: json.RawMessage(`{"name": "etl", "notifier": "dummy", "next_signal": "1h"}`), FirstSignal: "soon"}},
+		{{Signal: json.RawMessage(`{"name": "etl", "notifier": "dummy", "all_clear": "no"}`)}},
+		{
+			{Signal: json.RawMessage(`{"name": "etl", "notifier": "dummy", "next_signal": "1h"}`)},
+			{Signal: json.RawMessage(`{"name": "etl", "notifier": "dummy", "next_signal": "2h"}`)},
+		},
+	} {
+		a := Server{Notifiers: notifiers{"dummy": &DummyNotifier{}}, Storage: storageSetup(t), Signals: declared}
+		_, err = a.Handler()
+		assert.Error(t, err, declared)
+	}
 }
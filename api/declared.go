@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+
+	"nanny/pkg/nanny"
+	"nanny/pkg/storage"
+
+	log "github.com/mgutz/logxi"
+	"github.com/pkg/errors"
+)
+
+// Declared is a signal declared in config, so that nanny expects it since start
+// even when the program never called. Its name is used as is, address of the
+// caller is not appended, so the program should call with X-Dont-Modify-Name
+// header or the name should contain its address, e.g. "backup@10.0.0.5".
+type Declared struct {
+	// JSON-encoded settings of the signal, same as sent to the signal endpoint, it
+	// may use a profile. Fields present override the profile, even false or zero
+	// ones, e.g. {"name": "backup@10.0.0.5", "profile": "nightly", "all_clear": false}.
+	Signal json.RawMessage
+	// Optional deadline of the first signal after start, a duration like
+	// next_signal, not a time. The usual deadline of the signal is used when empty.
+	FirstSignal string
+}
+
+// declaredNames returns names of declared signals, see loadStorage. Invalid ones
+// are left out, loadDeclared rejects them.
+func declaredNames(declared []Declared) map[string]bool {
+	names := make(map[string]bool, len(declared))
+	for _, d := range declared {
+		var signal Signal
+		if err := json.Unmarshal(d.Signal, &signal); err == nil {
+			names[signal.Name] = true
+		}
+	}
+	return names
+}
+
+// loadDeclared reconciles declared signals with signals loaded from storage.
+// Declared signals which are not registered yet get a timer expecting their first
+// signal, registered ones keep their state and their settings are updated from
+// config. Both are saved to storage.
+func loadDeclared(n *nanny.Nanny, notifiers notifiers, store storage.Storage, profiles profiles, declared []Declared) error {
+	seen := make(map[string]bool, len(declared))
+	for _, d := range declared {
+		var signal Signal
+		err := json.Unmarshal(d.Signal, &signal)
+		if err != nil {
+			return errors.Wrap(err, "unable to decode declared signal")
+		}
+		name := signal.Name
+		if name == "" {
+			return errors.New("declared signal must have name")
+		}
+		if seen[name] {
+			return errors.Errorf("signal %s is declared more than once", name)
+		}
+		seen[name] = true
+
+		err = profiles.apply(d.Signal, &signal)
+		if err != nil {
+			return errors.Wrapf(err, "invalid declared signal %s", name)
+		}
+		s, err := buildSignal(n, notifiers, signal, name)
+		if err != nil {
+			return errors.Wrapf(err, "invalid declared signal %s", name)
+		}
+		s.Declared = true
+		first, err := constructDuration(d.FirstSignal)
+		if err != nil {
+			return errors.Wrapf(err, "invalid first_signal of declared signal %s", name)
+		}
+
+		registered := n.GetTimer(name) != nil
+		err = n.Expect(s, first)
+		if err != nil {
+			return errors.Wrapf(err, "invalid declared signal %s", name)
+		}
+		timer := n.GetTimer(name)
+		saveSignal(store, timer)
+		log.Info("Declared signal expected.",
+			"program", name,
+			"registered", registered,
+			"state", timer.State(),
+			"next_signal", timer.Status().NextSignal.String())
+	}
+	return nil
+}
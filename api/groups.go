@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nanny/pkg/closer"
+	"nanny/pkg/nanny"
+	"nanny/pkg/storage"
+
+	"github.com/gorilla/mux"
+	log "github.com/mgutz/logxi"
+	"github.com/pkg/errors"
+)
+
+// Group represents incomming JSON-encoded quorum group of signals.
+type Group struct {
+	Name string `json:"name"`
+	// Members are signals whose name starts with prefix, e.g. "worker@", and whose
+	// meta contains all of meta. At least one of them must be set.
+	Prefix   string            `json:"prefix"`
+	Meta     map[string]string `json:"meta"`
+	MinAlive int               `json:"min_alive"` // Minimum number of alive members.
+	// Notifier may be a single name or a list of names.
+	Notifier NotifierList `json:"notifier"`
+	// Activate optional all-clear notification that is sent when the group is alive again.
+	AllClear bool `json:"all_clear"`
+}
+
+// getGroupsHandler lists all groups and their state.
+func getGroupsHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+
+	quorums := n.GetQuorums()
+	if quorums == nil {
+		quorums = make([]*nanny.Quorum, 0)
+	}
+	err := json.NewEncoder(w).Encode(&struct {
+		Groups []*nanny.Quorum `json:"groups"`
+	}{
+		Groups: quorums,
+	})
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// getGroupHandler shows one group.
+func getGroupHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(req)["name"]
+
+	q := n.GetQuorum(name)
+	if q == nil {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find group: %s", name),
+		}
+	}
+	err := json.NewEncoder(w).Encode(q)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// groupHandler creates new group, or replaces existing group with the same name.
+func groupHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	var group Group
+
+	dec := json.NewDecoder(req.Body)
+	defer closer.Close(req.Body)
+
+	err := dec.Decode(&group)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        errors.Wrap(err, "unable to decode JSON"),
+		}
+	}
+
+	notifs, err := constructNotifiers(group.Notifier, notifiers)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        err,
+		}
+	}
+	err = n.AddGroup(nanny.Group{
+		Name:      group.Name,
+		Prefix:    group.Prefix,
+		Meta:      group.Meta,
+		MinAlive:  group.MinAlive,
+		Notifier:  notifs[0],
+		Notifiers: notifs[1:],
+		AllClear:  group.AllClear,
+	})
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        err,
+		}
+	}
+
+	// Errors are not on the API but only logged, the group works anyway.
+	saveGroup(store, n.GetQuorum(group.Name))
+	fmt.Fprint(w, `{"status_code":200, "status":"OK"}`)
+	return nil
+}
+
+// deleteGroupHandler removes group from nanny and persistent storage.
+func deleteGroupHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(req)["name"]
+
+	if !n.RemoveGroup(name) {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find group: %s", name),
+		}
+	}
+
+	err := store.RemoveGroup(storage.Group{Name: name})
+	if err != nil {
+		log.Error("Error removing group from persistent storage", "err", err)
+	}
+	// nolint: errcheck
+	w.Write([]byte(`{"status_code":200, "status":"OK"}`))
+	return nil
+}
+
+// loadGroups loads persisted groups with their state. Groups go after signals,
+// so that they count restored members.
+func loadGroups(n *nanny.Nanny, notifiers notifiers, store storage.Storage) {
+	groups, err := store.LoadGroups()
+	if err != nil {
+		log.Warn("Unable to load persisted groups. You may not be notified about them.", "err", err)
+		return
+	}
+
+	for _, group := range groups {
+		notifs, err := constructNotifiers(append(NotifierList{group.Notifier}, group.Notifiers...), notifiers)
+		if err != nil {
+			msg := "Unable to load persisted group, its notifier is no longer enabled, " +
+				"please register it again."
+			log.Warn(msg, "group", group.Name, "err", err)
+			continue
+		}
+		err = n.RestoreGroup(nanny.Group{
+			Name:      group.Name,
+			Prefix:    group.Prefix,
+			Meta:      group.Meta,
+			MinAlive:  group.MinAlive,
+			Notifier:  notifs[0],
+			Notifiers: notifs[1:],
+			AllClear:  group.AllClear,
+		}, nanny.GroupStatus{
+			State:       nanny.State(group.State),
+			AlertedAt:   group.AlertedAt,
+			RecoveredAt: group.RecoveredAt,
+		})
+		if err != nil {
+			log.Warn("Unable to load persisted group.", "group", group.Name, "err", err)
+			continue
+		}
+		log.Info("Loaded persisted group successful.", "group", group.Name, "state", group.State)
+	}
+}
+
+// saveGroup persists group and its state. The error is only logged, notifications
+// will still work.
+func saveGroup(store storage.Storage, q *nanny.Quorum) {
+	if q == nil {
+		return
+	}
+	group := q.Group()
+	status := q.Status()
+
+	var others []string
+	for _, notif := range group.Notifiers {
+		others = append(others, notif.String())
+	}
+	err := store.SaveGroup(storage.Group{
+		Name:        group.Name,
+		Prefix:      group.Prefix,
+		Meta:        group.Meta,
+		MinAlive:    group.MinAlive,
+		Notifier:    group.Notifier.String(),
+		Notifiers:   others,
+		AllClear:    group.AllClear,
+		State:       string(status.State),
+		AlertedAt:   status.AlertedAt,
+		RecoveredAt: status.RecoveredAt,
+	})
+	if err != nil {
+		log.Error("Error saving group to persistent storage", "err", err)
+	}
+}
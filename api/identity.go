@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"nanny/pkg/nanny"
+	"nanny/pkg/storage"
+
+	log "github.com/mgutz/logxi"
+	"github.com/pkg/errors"
+)
+
+// Identity is a policy resolving identity of the caller, which is appended to the
+// program name and recorded with the signal. By default it is address of the
+// caller, or the address forwarded by trusted proxies in Forwarded (RFC 7239) or
+// X-Forwarded-For header.
+type Identity struct {
+	// Optional addresses or CIDRs of proxies trusted to forward address of the
+	// caller, e.g. "10.0.0.0/8". Forwarding headers of other callers are ignored,
+	// the closest forwarded address which is not a trusted proxy is the caller.
+	// When empty, forwarding headers are ignored, any caller could send them.
+	TrustedProxies []string
+	// Optional header with identity of the caller set by a trusted proxy, e.g.
+	// "X-Client-Name". It is used instead of the address when sent by a trusted
+	// proxy, see TrustedProxies.
+	Header string
+	// Optional meta key of the signal with hostname of the caller, e.g. "host". It
+	// is used instead of the address when sent.
+	MetaHost string
+	// Use hostname of the address found by reverse DNS. Hostnames are looked up
+	// in the background, the address is used until its hostname is known or when
+	// the lookup fails. See hostTTL.
+	ReverseDNS bool
+
+	proxies []*net.IPNet
+	hosts   *hostCache
+}
+
+const (
+	// lookupTimeout limits reverse DNS lookup of the caller.
+	lookupTimeout = time.Duration(2) * time.Second
+	// hostTTL is how long hostnames found by reverse DNS are used before they
+	// are looked up again. The last known hostname is used meanwhile.
+	hostTTL = time.Duration(5) * time.Minute
+	// hostUnused is how long hostname of an address which does not call is kept.
+	hostUnused = time.Duration(7*24) * time.Hour
+)
+
+// hostCache caches hostnames of addresses found by reverse DNS.
+type hostCache struct {
+	hosts map[string]cachedHost
+	lock  sync.Mutex
+}
+
+// cachedHost is hostname of an address, or the address until it is found.
+type cachedHost struct {
+	name    string
+	expires time.Time // When to look the hostname up again.
+	used    time.Time
+	pending bool // Lookup is running.
+}
+
+// handlerWithIdentity is handlerWithProfiles which resolves identity of callers.
+type handlerWithIdentity func(*Identity, profiles, *nanny.Nanny, notifiers, storage.Storage, http.ResponseWriter, *http.Request) error
+
+// newIdentity validates identity policy, parsing its trusted proxies.
+func newIdentity(identity Identity) (*Identity, error) {
+	p := identity
+	p.proxies = nil
+	for _, proxy := range identity.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, errors.Errorf("invalid trusted proxy: %s", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			p.proxies = append(p.proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy: %s", proxy)
+		}
+		p.proxies = append(p.proxies, network)
+	}
+	if p.Header != "" && len(p.proxies) == 0 {
+		log.Warn("Identity header is ignored without trusted proxies.", "header", p.Header)
+	}
+	p.hosts = &hostCache{hosts: make(map[string]cachedHost)}
+	return &p, nil
+}
+
+// constructName resolves identity of the caller and appends it to the program name
+// in format {programName}@{identity}, unless X-Dont-Modify-Name header is sent.
+// Returns the name and the identity. Nil policy is the default one.
+func (p *Identity) constructName(name string, req *http.Request, meta map[string]string) (string, string) {
+	identity := p.resolve(req, meta)
+	if req.Header.Get("X-Dont-Modify-Name") != "" {
+		return name, identity
+	}
+	return fmt.Sprintf("%s@%s", name, identity), identity
+}
+
+// resolve returns identity of the caller: value of identity header, hostname from
+// meta, or address of the caller, optionally its hostname.
+func (p *Identity) resolve(req *http.Request, meta map[string]string) string {
+	if p == nil {
+		p = &Identity{}
+	}
+	remote := splitHost(req.RemoteAddr)
+	trusted := p.trusts(remote)
+	if trusted && p.Header != "" {
+		if value := strings.TrimSpace(req.Header.Get(p.Header)); value != "" {
+			return value
+		}
+	}
+	if p.MetaHost != "" && meta[p.MetaHost] != "" {
+		return meta[p.MetaHost]
+	}
+
+	addr := remote
+	if trusted {
+		addr = p.forwarded(req, remote)
+	}
+	if p.ReverseDNS {
+		return p.hosts.lookup(addr)
+	}
+	return addr
+}
+
+// lookup returns hostname of the address found by reverse DNS, or the address
+// until it is known. Callers do not wait for the lookup, it runs in the
+// background when the hostname is not known or expired. Nil cache does not look
+// hostnames up.
+func (c *hostCache) lookup(addr string) string {
+	if c == nil {
+		return addr
+	}
+	now := time.Now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	host, ok := c.hosts[addr]
+	if !ok {
+		host = cachedHost{name: addr}
+	}
+	host.used = now
+	if !host.pending && !now.Before(host.expires) {
+		host.pending = true
+		go c.refresh(addr)
+	}
+	c.hosts[addr] = host
+	return host.name
+}
+
+// refresh looks up hostname of the address. The last known name is kept when
+// the lookup fails.
+func (c *hostCache) refresh(addr string) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	names, err := net.DefaultResolver.LookupAddr(ctx, addr)
+	if err != nil || len(names) == 0 {
+		log.Warn("Unable to find hostname of caller, using its last known name.", "addr", addr, "err", err)
+	}
+
+	now := time.Now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// Drop hostnames of addresses which stopped calling, so that the cache does
+	// not grow with callers.
+	for key, host := range c.hosts {
+		if !host.pending && now.Sub(host.used) > hostUnused {
+			delete(c.hosts, key)
+		}
+	}
+	host := c.hosts[addr]
+	if host.name == "" {
+		host.name = addr
+	}
+	if err == nil && len(names) > 0 {
+		host.name = strings.TrimSuffix(names[0], ".")
+	}
+	host.expires = now.Add(hostTTL)
+	host.pending = false
+	c.hosts[addr] = host
+}
+
+// trusts returns true when forwarding headers sent from given address are trusted,
+// the address must be a trusted proxy.
+func (p *Identity) trusts(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarded returns address of the caller forwarded by trusted proxies. Forwarded
+// addresses are walked from the closest proxy, the first one which is not a
+// trusted proxy is the caller. Walk stops at unknown or obfuscated address.
+// Forwarded header takes precedence over X-Forwarded-For.
+func (p *Identity) forwarded(req *http.Request, remote string) string {
+	chain := forwardedFor(req.Header.Values("Forwarded"))
+	if len(chain) == 0 {
+		chain = splitList(req.Header.Values("X-Forwarded-For"))
+	}
+
+	addr := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		host := splitHost(chain[i])
+		if net.ParseIP(host) == nil {
+			break
+		}
+		addr = host
+		if !p.trusts(host) {
+			break
+		}
+	}
+	return addr
+}
+
+// forwardedFor returns "for" parameters of Forwarded header elements, e.g.
+// `for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"`. Elements without it
+// are "unknown".
+func forwardedFor(values []string) []string {
+	var chain []string
+	for _, element := range splitList(values) {
+		addr := "unknown"
+		for _, pair := range strings.Split(element, ";") {
+			i := strings.Index(pair, "=")
+			if i < 0 || !strings.EqualFold(strings.TrimSpace(pair[:i]), "for") {
+				continue
+			}
+			addr = strings.Trim(strings.TrimSpace(pair[i+1:]), `"`)
+		}
+		chain = append(chain, addr)
+	}
+	return chain
+}
+
+// splitList splits comma-separated header values, skipping empty ones.
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// splitHost strips port, and brackets of IPv6 address, from address.
+func splitHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
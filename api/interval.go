@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"nanny/pkg/closer"
+	"nanny/pkg/nanny"
+	"nanny/pkg/storage"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// Interval represents incomming JSON-encoded override of the learned interval.
+type Interval struct {
+	// Expected interval between calls, a duration like next_signal, not a time.
+	// Empty interval starts learning again.
+	Interval string `json:"interval"`
+	// Tolerance of the interval, a duration like next_signal, not a time.
+	Grace string `json:"grace"`
+}
+
+// intervalSignalHandler overrides the interval learned by the signal, see
+// Signal.LearnPings.
+func intervalSignalHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(req)["name"]
+	var interval Interval
+
+	dec := json.NewDecoder(req.Body)
+	defer closer.Close(req.Body)
+
+	err := dec.Decode(&interval)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        errors.Wrap(err, "unable to decode JSON"),
+		}
+	}
+
+	var d durations
+	every, grace := d.parse("interval", interval.Interval), d.parse("grace", interval.Grace)
+	if d.err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        d.err,
+		}
+	}
+
+	timer := n.GetTimer(name)
+	if timer == nil {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find signal: %s", name),
+		}
+	}
+	err = timer.SetInterval(every, grace)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusConflict,
+			Err:        errors.Wrapf(err, "unable to set interval of signal: %s", name),
+		}
+	}
+	saveSignal(store, timer)
+	// nolint: errcheck
+	w.Write([]byte(`{"status_code":200, "status":"OK"}`))
+	return nil
+}
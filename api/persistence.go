@@ -0,0 +1,409 @@
+package api
+
+import (
+	"time"
+
+	"nanny/pkg/calendar"
+	"nanny/pkg/nanny"
+	"nanny/pkg/notifier"
+	"nanny/pkg/storage"
+
+	log "github.com/mgutz/logxi"
+)
+
+// loadStorage loads persisted signals. This function does not return error but logs
+// information directly (for better error messages). Declared signals are never
+// stale, see Declared. Signals no longer declared are removed when the program
+// never called, others are kept as any other signal.
+func loadStorage(n *nanny.Nanny, notifiers notifiers, store storage.Storage, declared map[string]bool) {
+	signals, err := store.Load()
+	if err != nil {
+		msg := "Unable to load persisted signals. " +
+			"There may have been saved signals you will not be notified about! " +
+			"Please check services using Nanny manually."
+		log.Warn(msg)
+		return
+	}
+
+	// Create nanny timers from persisted signals.
+	for _, signal := range signals {
+		undeclared := signal.Declared && !declared[signal.Name]
+		if undeclared && signal.LastSignal.IsZero() {
+			// Program removed from config never called, nobody expects it.
+			log.Info("Removing signal which is no longer declared.", "program", signal.Name)
+			err = store.Remove(signal)
+			if err != nil {
+				log.Error("Unable to remove signal which is no longer declared.", "err", err)
+			}
+			continue
+		}
+		state := nanny.State(signal.State)
+		// If NextSignal (with grace period) would be in the past, notify user, and delete it.
+		// Alerting and paused signals are restored, they do not wait for the next signal.
+		// Inverse signals do not wait for any signal at all, neither do signals learning
+		// their interval. Declared signals are restored to alert when overdue.
+		learning := signal.LearnPings > 0 && signal.Interval == 0 && signal.LearnedInterval == 0
+		if state != nanny.StateAlerting && state != nanny.StatePaused && !signal.Inverse && !learning && !declared[signal.Name] &&
+			signal.NextSignal.Add(signal.Grace).Before(time.Now()) {
+			msg := "Found previously stored notifier that is stale. Please check " +
+				"this program manually."
+			log.Warn(msg, "program", signal.Name, "should_notify", signal.NextSignal.String())
+			err = store.Remove(signal)
+			if err != nil {
+				log.Error("Unable to remove stale signal.", "err", err)
+			}
+			continue
+		}
+
+		notif, ok := notifiers[signal.Notifier]
+		if !ok {
+			msg := "Unable to find previously stored notifier. It may have been " +
+				"disabled. Please check this program manually."
+			log.Warn(msg, "program", signal.Name)
+		}
+		var others []notifier.Notifier
+		for _, name := range signal.Notifiers {
+			other, ok := notifiers[name]
+			if !ok {
+				msg := "Unable to find previously stored notifier. It may have been " +
+					"disabled. Please check this program manually."
+				log.Warn(msg, "program", signal.Name, "notifier", name)
+				continue
+			}
+			others = append(others, other)
+		}
+		schedule, loc, err := constructSchedule(signal.Schedule, signal.Timezone)
+		if err != nil {
+			msg := "Unable to load schedule of previously stored signal, " +
+				"please check this program manually."
+			log.Warn(msg, "program", signal.Name, "err", err)
+			continue
+		}
+		rules, holidays, err := loadIntervalRules(signal, n.Calendars)
+		if err != nil {
+			msg := "Unable to load interval rules of previously stored signal, " +
+				"please check this program manually."
+			log.Warn(msg, "program", signal.Name, "err", err)
+			continue
+		}
+		if len(rules) > 0 && loc == nil {
+			loc, err = constructLocation(signal.Timezone)
+			if err != nil {
+				msg := "Unable to load time zone of previously stored signal, " +
+					"please check this program manually."
+				log.Warn(msg, "program", signal.Name, "err", err)
+				continue
+			}
+		}
+		assertions, err := constructAssertions(signal.Assertions)
+		if err != nil {
+			msg := "Unable to load assertions of previously stored signal, " +
+				"please check this program manually."
+			log.Warn(msg, "program", signal.Name, "err", err)
+			continue
+		}
+		// Signals persisted by older versions do not have interval stored.
+		interval := signal.Interval
+		if interval == 0 && schedule == nil && !signal.Inverse && signal.MinThroughput == 0 && signal.LearnPings == 0 {
+			interval = time.Until(signal.NextSignal)
+		}
+		s := nanny.Signal{
+			Name:       signal.Name,
+			Identity:   signal.Identity,
+			Notifier:   notif,
+			Notifiers:  others,
+			NextSignal: interval,
+			Deadline:   signal.Deadline,
+			Declared:   declared[signal.Name],
+			Grace:      signal.Grace,
+			AllClear:   signal.AllClear,
+			Repeat:     signal.Repeat,
+			Escalation: loadEscalation(signal, notifiers),
+			Meta:       signal.Meta,
+			Schedule:   schedule,
+			Location:   loc,
+			Tolerance:  signal.Tolerance,
+			Rules:      rules,
+			Holidays:   holidays,
+			MaxRuntime: signal.MaxRuntime,
+			DependsOn:  signal.DependsOn,
+
+			FlapWindow:    signal.FlapWindow,
+			FlapThreshold: signal.FlapThreshold,
+			StablePings:   signal.StablePings,
+			StableFor:     signal.StableFor,
+
+			MinInterval: signal.MinInterval,
+			MaxRate:     signal.MaxRate,
+			RateWindow:  signal.RateWindow,
+
+			Inverse:  signal.Inverse,
+			Cooldown: signal.Cooldown,
+
+			MinThroughput:    signal.MinThroughput,
+			ThroughputWindow: signal.ThroughputWindow,
+			Assertions:       assertions,
+			StallAfter:       signal.StallAfter,
+			RuntimeFactor:    signal.RuntimeFactor,
+			LearnPings:       signal.LearnPings,
+		}
+
+		err = n.Restore(s, nanny.Status{
+			State:       state,
+			NextSignal:  signal.NextSignal,
+			LastSignal:  signal.LastSignal,
+			AlertedAt:   signal.AlertedAt,
+			RecoveredAt: signal.RecoveredAt,
+			NotifiedAt:  signal.NotifiedAt,
+			Step:        signal.Step,
+			Reminders:   signal.Reminders,
+			Ack: nanny.Ack{
+				By:    signal.AckBy,
+				Note:  signal.AckNote,
+				At:    signal.AckAt,
+				Until: signal.AckUntil,
+			},
+			Kind:        notifier.Kind(signal.Kind),
+			RunStarted:  signal.RunStarted,
+			RunDeadline: signal.RunDeadline,
+			LastRuntime: signal.LastRuntime,
+			Runtimes:    loadRuntimes(store, signal.Name),
+			ExitCode:    signal.ExitCode,
+			Log:         signal.Log,
+
+			Transitions:     signal.Transitions,
+			Flapping:        signal.Flapping,
+			AllClearPending: signal.AllClearPending,
+			StableSince:     signal.StableSince,
+			Pings:           signal.Pings,
+
+			Arrivals: signal.Arrivals,
+			Early:    signal.Early,
+			Frequent: signal.Frequent,
+
+			Tally: loadTally(signal.Tally),
+
+			Values:    signal.Values,
+			Assertion: signal.Assertion,
+
+			Progress:     signal.Progress,
+			ProgressedAt: signal.ProgressedAt,
+
+			Intervals:       signal.Intervals,
+			LearnedInterval: signal.LearnedInterval,
+			LearnedGrace:    signal.LearnedGrace,
+		})
+		if err != nil {
+			msg := "Unable to create signal handler from previous run," +
+				" please check this program manually."
+			log.Warn(msg, "program", signal.Name, "err", err)
+			continue
+		}
+		if undeclared {
+			// Program which called is kept as any other signal.
+			log.Info("Signal is no longer declared.", "program", signal.Name)
+			saveSignal(store, n.GetTimer(signal.Name))
+		}
+		log.Info("Loaded persisted signal successful.",
+			"program", signal.Name,
+			"state", signal.State,
+			"next_signal", s.NextSignal.String(),
+			"grace", s.Grace.String(),
+			"all_clear", s.AllClear,
+			"meta", s.Meta,
+			"notifier", signal.Notifier,
+			"notifiers", signal.Notifiers)
+	}
+}
+
+// loadEscalation creates escalation steps from persisted signal, skipping steps
+// with notifiers that are no longer enabled.
+func loadEscalation(signal storage.Signal, notifiers notifiers) []nanny.EscalationStep {
+	var steps []nanny.EscalationStep
+	for _, step := range signal.Escalation {
+		notif, ok := notifiers[step.Notifier]
+		if !ok {
+			msg := "Unable to find previously stored escalation notifier. It may have been " +
+				"disabled. Please check this program manually."
+			log.Warn(msg, "program", signal.Name, "notifier", step.Notifier)
+			continue
+		}
+		steps = append(steps, nanny.EscalationStep{
+			After:    step.After,
+			Notifier: notif,
+			Repeat:   step.Repeat,
+		})
+	}
+	return steps
+}
+
+// storeSignal converts timer to its persisted form.
+func storeSignal(timer *nanny.Timer) storage.Signal {
+	signal := timer.Signal()
+	status := timer.Status()
+
+	var others []string
+	for _, notif := range signal.Notifiers {
+		others = append(others, notif.String())
+	}
+	var escalation []storage.EscalationStep
+	for _, step := range signal.Escalation {
+		escalation = append(escalation, storage.EscalationStep{
+			After:    step.After,
+			Notifier: step.Notifier.String(),
+			Repeat:   step.Repeat,
+		})
+	}
+	var assertions []string
+	for _, a := range signal.Assertions {
+		assertions = append(assertions, a.String())
+	}
+
+	var rules []storage.IntervalRule
+	for _, r := range signal.Rules {
+		rules = append(rules, storage.IntervalRule{
+			Days:       r.Days(),
+			From:       r.From,
+			To:         r.To,
+			NextSignal: r.NextSignal,
+		})
+	}
+	var holidays string
+	if signal.Holidays != nil {
+		holidays = signal.Holidays.String()
+	}
+
+	var schedule, timezone string
+	if signal.Schedule != nil {
+		schedule = signal.Schedule.String()
+	}
+	if signal.Location != nil {
+		timezone = signal.Location.String()
+	}
+
+	return storage.Signal{
+		Name:        signal.Name,
+		Identity:    signal.Identity,
+		Notifier:    signal.Notifier.String(),
+		Notifiers:   others,
+		NextSignal:  status.NextSignal,
+		Interval:    signal.NextSignal,
+		Deadline:    signal.Deadline,
+		Declared:    signal.Declared,
+		Grace:       signal.Grace,
+		AllClear:    signal.AllClear,
+		Repeat:      signal.Repeat,
+		Escalation:  escalation,
+		Meta:        signal.Meta,
+		Schedule:    schedule,
+		Timezone:    timezone,
+		Tolerance:   signal.Tolerance,
+		MaxRuntime:  signal.MaxRuntime,
+		Holidays:    holidays,
+		DependsOn:   signal.DependsOn,
+		State:       string(status.State),
+		LastSignal:  status.LastSignal,
+		AlertedAt:   status.AlertedAt,
+		RecoveredAt: status.RecoveredAt,
+		NotifiedAt:  status.NotifiedAt,
+		Step:        status.Step,
+		Reminders:   status.Reminders,
+		AckBy:       status.Ack.By,
+		AckNote:     status.Ack.Note,
+		AckAt:       status.Ack.At,
+		AckUntil:    status.Ack.Until,
+		Kind:        string(status.Kind),
+		RunStarted:  status.RunStarted,
+		RunDeadline: status.RunDeadline,
+		LastRuntime: status.LastRuntime,
+		ExitCode:    status.ExitCode,
+		Log:         status.Log,
+
+		FlapWindow:       signal.FlapWindow,
+		FlapThreshold:    signal.FlapThreshold,
+		StablePings:      signal.StablePings,
+		StableFor:        signal.StableFor,
+		Transitions:      status.Transitions,
+		Flapping:         status.Flapping,
+		AllClearPending:  status.AllClearPending,
+		StableSince:      status.StableSince,
+		Pings:            status.Pings,
+		MinInterval:      signal.MinInterval,
+		MaxRate:          signal.MaxRate,
+		RateWindow:       signal.RateWindow,
+		Arrivals:         status.Arrivals,
+		Early:            status.Early,
+		Frequent:         status.Frequent,
+		Inverse:          signal.Inverse,
+		Cooldown:         signal.Cooldown,
+		MinThroughput:    signal.MinThroughput,
+		ThroughputWindow: signal.ThroughputWindow,
+		Tally:            storeTally(status.Tally),
+		Assertions:       assertions,
+		Values:           status.Values,
+		Assertion:        status.Assertion,
+		StallAfter:       signal.StallAfter,
+		RuntimeFactor:    signal.RuntimeFactor,
+		Progress:         status.Progress,
+		ProgressedAt:     status.ProgressedAt,
+		LearnPings:       signal.LearnPings,
+		Intervals:        status.Intervals,
+		LearnedInterval:  status.LearnedInterval,
+		LearnedGrace:     status.LearnedGrace,
+		IntervalRules:    rules,
+	}
+}
+
+// saveSignal persists timer. The error is only logged, notifications will still
+// work.
+func saveSignal(store storage.Storage, timer *nanny.Timer) {
+	if timer == nil {
+		return
+	}
+	err := store.Save(storeSignal(timer))
+	if err != nil {
+		log.Error("Error saving signal to persistent storage", "err", err)
+	}
+}
+
+// loadTally converts stored tallies of throughput signal.
+func loadTally(stored []storage.Tally) []nanny.Tally {
+	var tally []nanny.Tally
+	for _, t := range stored {
+		tally = append(tally, nanny.Tally{At: t.At, Count: t.Count})
+	}
+	return tally
+}
+
+// storeTally converts tallies of throughput signal to be stored.
+func storeTally(tally []nanny.Tally) []storage.Tally {
+	var stored []storage.Tally
+	for _, t := range tally {
+		stored = append(stored, storage.Tally{At: t.At, Count: t.Count})
+	}
+	return stored
+}
+
+// loadIntervalRules creates interval rules of persisted signal and looks up their
+// holiday calendar.
+func loadIntervalRules(signal storage.Signal, calendars map[string]*calendar.Calendar) ([]nanny.IntervalRule, *calendar.Calendar, error) {
+	var rules []nanny.IntervalRule
+	for _, r := range signal.IntervalRules {
+		weekdays, holidays, err := nanny.ParseDays(r.Days)
+		if err != nil {
+			return nil, nil, err
+		}
+		rules = append(rules, nanny.IntervalRule{
+			Weekdays:   weekdays,
+			Holidays:   holidays,
+			From:       r.From,
+			To:         r.To,
+			NextSignal: r.NextSignal,
+		})
+	}
+	holidays, err := constructHolidays(signal.Holidays, calendars)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rules, holidays, nil
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+
+	"nanny/pkg/nanny"
+	"nanny/pkg/storage"
+
+	"github.com/pkg/errors"
+)
+
+// Profile is a named set of signal settings, e.g. notifier, next_signal, grace,
+// all_clear and escalation, defined in config. Signal uses it when it names the
+// profile in "profile", or when its name matches Match. Fields sent explicitly
+// in the signal override the profile.
+type Profile struct {
+	Name string
+	// Optional glob pattern of program names using the profile unless they name
+	// another one, e.g. "backup-*". The name is matched before address of the
+	// caller is appended.
+	Match  string
+	Signal Signal // Settings of the profile.
+
+	data []byte // JSON-encoded Signal, signals are decoded on top of its copy.
+}
+
+type profiles []Profile
+
+// handlerWithProfiles is handlerWithDeps which uses signal profiles.
+type handlerWithProfiles func(profiles, *nanny.Nanny, notifiers, storage.Storage, http.ResponseWriter, *http.Request) error
+
+// newProfiles validates profiles like signals, their notifiers must be enabled.
+// Profiles are sorted by name, the first profile matching signal name is used.
+func newProfiles(list []Profile, n *nanny.Nanny, notifiers notifiers) (profiles, error) {
+	sorted := make(profiles, len(list))
+	copy(sorted, list)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for i, p := range sorted {
+		data, err := json.Marshal(p.Signal)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to encode profile %s", p.Name)
+		}
+		sorted[i].data = data
+		if _, err := path.Match(p.Match, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid match of profile %s", p.Name)
+		}
+		known := notifiers
+		if _, ok := notifiers[""]; !ok && len(p.Signal.Notifier) == 0 {
+			// Signals using the profile name their notifier.
+			known = notifiers.with("")
+		}
+		if _, err := buildSignal(n, known, p.Signal, p.Name); err != nil {
+			return nil, errors.Wrapf(err, "invalid profile %s", p.Name)
+		}
+	}
+	return sorted, nil
+}
+
+// find returns profile of given name, or the first profile matching program name
+// when name is empty. Nil profile is returned when no profile matches.
+func (p profiles) find(name, program string) (*Profile, error) {
+	for i := range p {
+		if name != "" && p[i].Name == name {
+			return &p[i], nil
+		}
+	}
+	if name != "" {
+		return nil, errors.Errorf("unable to find profile: %s", name)
+	}
+	for i := range p {
+		if p[i].Match == "" {
+			continue
+		}
+		if matched, _ := path.Match(p[i].Match, program); matched {
+			return &p[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// apply decodes JSON-encoded signal on top of the profile used by the signal, so
+// that fields sent explicitly override the profile.
+func (p profiles) apply(data []byte, signal *Signal) error {
+	profile, err := p.find(signal.Profile, signal.Name)
+	if err != nil || profile == nil {
+		return err
+	}
+	// Decoding reuses slices and maps, the profile is decoded to keep it intact.
+	*signal = Signal{}
+	err = json.Unmarshal(profile.data, signal)
+	if err != nil {
+		return errors.Wrapf(err, "unable to decode profile %s", profile.Name)
+	}
+	return errors.Wrap(json.Unmarshal(data, signal), "unable to decode JSON")
+}
+
+// with returns copy of notifiers with placeholder of given name.
+func (n notifiers) with(name string) notifiers {
+	copied := notifiers{name: nil}
+	for k, v := range n {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"nanny/pkg/closer"
+	"nanny/pkg/nanny"
+	"nanny/pkg/storage"
+
+	"github.com/gorilla/mux"
+	log "github.com/mgutz/logxi"
+	"github.com/pkg/errors"
+)
+
+// Silence represents JSON-encoded silence suppressing notifications of matching
+// signals.
+type Silence struct {
+	ID       string    `json:"id"`
+	Matchers []Matcher `json:"matchers"` // All matchers must match the signal.
+	// When the silence starts, RFC3339 time. Defaults to now.
+	Start string `json:"start"`
+	// When the silence ends, RFC3339 time or duration counted from start, e.g. "2h".
+	// May be empty for recurring silences.
+	End       string `json:"end"`
+	CreatedBy string `json:"created_by"`
+	Comment   string `json:"comment"`
+	// Optional recurring window: the silence is active for duration after each
+	// time matching cron expression, evaluated in timezone (UTC by default).
+	Cron     string `json:"cron,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	// Whether the silence is active now, ignored in requests.
+	Active bool `json:"active"`
+}
+
+// Matcher represents JSON-encoded silence matcher.
+type Matcher struct {
+	// Meta key to match, signal name is matched when empty.
+	Meta string `json:"meta,omitempty"`
+	// Glob pattern like "backup-*", or regular expression when regex is set.
+	Value string `json:"value"`
+	Regex bool   `json:"regex,omitempty"`
+}
+
+// getSilencesHandler lists all silences.
+func getSilencesHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+
+	now := time.Now()
+	silences := make([]Silence, 0)
+	for _, s := range n.GetSilences() {
+		silences = append(silences, jsonSilence(s, now))
+	}
+
+	err := json.NewEncoder(w).Encode(&struct {
+		Silences []Silence `json:"silences"`
+	}{
+		Silences: silences,
+	})
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// getSilenceHandler shows one silence.
+func getSilenceHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	id := mux.Vars(req)["id"]
+
+	s, ok := n.GetSilence(id)
+	if !ok {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find silence: %s", id),
+		}
+	}
+	err := json.NewEncoder(w).Encode(jsonSilence(s, time.Now()))
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// createSilenceHandler creates new silence.
+func createSilenceHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	return putSilence(n, store, "", w, req)
+}
+
+// updateSilenceHandler replaces existing silence.
+func updateSilenceHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	id := mux.Vars(req)["id"]
+	if _, ok := n.GetSilence(id); !ok {
+		w.Header().Set("Content-Type", "application/json")
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find silence: %s", id),
+		}
+	}
+	return putSilence(n, store, id, w, req)
+}
+
+// putSilence decodes silence from request and adds it to nanny with given ID,
+// new ID is generated when empty.
+func putSilence(n *nanny.Nanny, store storage.Storage, id string, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	var silence Silence
+
+	dec := json.NewDecoder(req.Body)
+	defer closer.Close(req.Body)
+
+	err := dec.Decode(&silence)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        errors.Wrap(err, "unable to decode JSON"),
+		}
+	}
+
+	s, err := constructSilence(silence, time.Now())
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        err,
+		}
+	}
+	s.ID = id
+	s, err = n.AddSilence(s)
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusBadRequest,
+			Err:        err,
+		}
+	}
+
+	// Errors are not on the API but only logged, the silence works anyway.
+	err = store.SaveSilence(storeSilence(s))
+	if err != nil {
+		log.Error("Error saving silence to persistent storage", "err", err)
+	}
+	fmt.Fprintf(w, `{"status_code":200, "status":"OK", "id":%q}`, s.ID)
+	return nil
+}
+
+// deleteSilenceHandler removes silence from nanny and persistent storage.
+func deleteSilenceHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	id := mux.Vars(req)["id"]
+
+	if !n.RemoveSilence(id) {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find silence: %s", id),
+		}
+	}
+
+	err := store.RemoveSilence(storage.Silence{ID: id})
+	if err != nil {
+		log.Error("Error removing silence from persistent storage", "err", err)
+	}
+	// nolint: errcheck
+	w.Write([]byte(`{"status_code":200, "status":"OK"}`))
+	return nil
+}
+
+// constructSilence converts JSON silence to nanny.Silence, the rest of the
+// validation is done by nanny.
+func constructSilence(jsonSilence Silence, now time.Time) (nanny.Silence, error) {
+	s := nanny.Silence{
+		Start:     now,
+		CreatedBy: jsonSilence.CreatedBy,
+		Comment:   jsonSilence.Comment,
+		Cron:      jsonSilence.Cron,
+	}
+	for _, m := range jsonSilence.Matchers {
+		s.Matchers = append(s.Matchers, nanny.Matcher{Meta: m.Meta, Value: m.Value, Regex: m.Regex})
+	}
+
+	var err error
+	if jsonSilence.Start != "" {
+		s.Start, err = time.Parse(time.RFC3339, jsonSilence.Start)
+		if err != nil {
+			return s, errors.Errorf("invalid start: %s, use RFC3339 time", jsonSilence.Start)
+		}
+	}
+	if jsonSilence.End != "" {
+		s.End, err = constructTime(jsonSilence.End, s.Start)
+		if err != nil {
+			return s, errors.Wrap(err, "invalid end")
+		}
+	}
+	if jsonSilence.Duration != "" {
+		s.Duration, err = time.ParseDuration(jsonSilence.Duration)
+		if err != nil {
+			return s, errors.Errorf("invalid duration: %s", jsonSilence.Duration)
+		}
+	}
+	if jsonSilence.Timezone != "" {
+		s.Location, err = time.LoadLocation(jsonSilence.Timezone)
+		if err != nil {
+			return s, errors.Errorf("unknown timezone: %s", jsonSilence.Timezone)
+		}
+	}
+	return s, nil
+}
+
+// jsonSilence converts nanny.Silence to its JSON representation.
+func jsonSilence(s nanny.Silence, now time.Time) Silence {
+	silence := Silence{
+		ID:        s.ID,
+		Start:     s.Start.Format(time.RFC3339),
+		CreatedBy: s.CreatedBy,
+		Comment:   s.Comment,
+		Cron:      s.Cron,
+		Active:    !s.ActiveUntil(now).IsZero(),
+	}
+	for _, m := range s.Matchers {
+		silence.Matchers = append(silence.Matchers, Matcher{Meta: m.Meta, Value: m.Value, Regex: m.Regex})
+	}
+	if !s.End.IsZero() {
+		silence.End = s.End.Format(time.RFC3339)
+	}
+	if s.Duration > 0 {
+		silence.Duration = s.Duration.String()
+	}
+	if s.Location != nil {
+		silence.Timezone = s.Location.String()
+	}
+	return silence
+}
+
+// loadSilences loads persisted silences, expired silences are removed.
+func loadSilences(n *nanny.Nanny, store storage.Storage) {
+	silences, err := store.LoadSilences()
+	if err != nil {
+		log.Warn("Unable to load persisted silences. You may be notified about silenced signals.", "err", err)
+		return
+	}
+
+	now := time.Now()
+	for _, silence := range silences {
+		s := nanny.Silence{
+			ID:        silence.ID,
+			Start:     silence.Start,
+			End:       silence.End,
+			CreatedBy: silence.CreatedBy,
+			Comment:   silence.Comment,
+			Cron:      silence.Cron,
+			Duration:  silence.Duration,
+		}
+		if s.Expired(now) {
+			err = store.RemoveSilence(silence)
+			if err != nil {
+				log.Error("Unable to remove expired silence.", "err", err)
+			}
+			continue
+		}
+		for _, m := range silence.Matchers {
+			s.Matchers = append(s.Matchers, nanny.Matcher{Meta: m.Meta, Value: m.Value, Regex: m.Regex})
+		}
+		if silence.Timezone != "" {
+			s.Location, err = time.LoadLocation(silence.Timezone)
+			if err != nil {
+				log.Warn("Unable to load time zone of persisted silence, using UTC.", "silence", silence.ID, "err", err)
+			}
+		}
+
+		_, err = n.AddSilence(s)
+		if err != nil {
+			log.Warn("Unable to load persisted silence.", "silence", silence.ID, "err", err)
+			continue
+		}
+		log.Info("Loaded persisted silence successful.", "silence", silence.ID, "comment", silence.Comment)
+	}
+}
+
+// storeSilence converts silence to its persisted form.
+func storeSilence(s nanny.Silence) storage.Silence {
+	silence := storage.Silence{
+		ID:        s.ID,
+		Start:     s.Start,
+		End:       s.End,
+		CreatedBy: s.CreatedBy,
+		Comment:   s.Comment,
+		Cron:      s.Cron,
+		Duration:  s.Duration,
+	}
+	for _, m := range s.Matchers {
+		silence.Matchers = append(silence.Matchers, storage.Matcher{Meta: m.Meta, Value: m.Value, Regex: m.Regex})
+	}
+	if s.Location != nil {
+		silence.Timezone = s.Location.String()
+	}
+	return silence
+}
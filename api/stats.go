@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"nanny/pkg/nanny"
+	"nanny/pkg/storage"
+
+	"github.com/gorilla/mux"
+	log "github.com/mgutz/logxi"
+	"github.com/pkg/errors"
+)
+
+// getStatsHandler shows statistics of runtimes of the signal's last finished runs.
+func getStatsHandler(n *nanny.Nanny, notifiers notifiers, store storage.Storage, w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(req)["name"]
+
+	timer := n.GetTimer(name)
+	if timer == nil {
+		return &httpError{
+			StatusCode: http.StatusNotFound,
+			Err:        errors.Errorf("unable to find signal: %s", name),
+		}
+	}
+	err := json.NewEncoder(w).Encode(timer.RunStats())
+	if err != nil {
+		return &httpError{
+			StatusCode: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// saveRun persists finished run of the signal. The error is only logged, the run
+// is still used by nanny until restart.
+func saveRun(store storage.Storage, name string, runtime time.Duration) {
+	err := store.SaveRun(storage.Run{
+		Signal:  name,
+		Started: time.Now().Add(-runtime),
+		Runtime: runtime,
+	}, nanny.RunHistory)
+	if err != nil {
+		log.Error("Error saving run to persistent storage", "err", err)
+	}
+}
+
+// loadRuntimes loads runtimes of the signal's last finished runs, oldest first.
+func loadRuntimes(store storage.Storage, name string) []time.Duration {
+	runs, err := store.LoadRuns(name, nanny.RunHistory)
+	if err != nil {
+		log.Warn("Unable to load persisted runs, statistics start over.", "program", name, "err", err)
+		return nil
+	}
+	var runtimes []time.Duration
+	for _, run := range runs {
+		runtimes = append(runtimes, run.Runtime)
+	}
+	return runtimes
+}
@@ -89,3 +89,17 @@ func depWrap(nanny *nanny.Nanny, notifiers notifiers, storage storage.Storage, h
 		return handler(nanny, notifiers, storage, w, r)
 	}
 }
+
+// profileWrap adds signal profiles to handler.
+func profileWrap(profiles profiles, handler handlerWithProfiles) handlerWithDeps {
+	return func(nanny *nanny.Nanny, notifiers notifiers, storage storage.Storage, w http.ResponseWriter, r *http.Request) error {
+		return handler(profiles, nanny, notifiers, storage, w, r)
+	}
+}
+
+// identityWrap adds identity policy to handler.
+func identityWrap(identity *Identity, handler handlerWithIdentity) handlerWithProfiles {
+	return func(profiles profiles, nanny *nanny.Nanny, notifiers notifiers, storage storage.Storage, w http.ResponseWriter, r *http.Request) error {
+		return handler(identity, profiles, nanny, notifiers, storage, w, r)
+	}
+}
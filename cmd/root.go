@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"nanny/api"
+	"nanny/pkg/calendar"
 	"nanny/pkg/closer"
 	"nanny/pkg/notifier"
 	"nanny/pkg/storage"
@@ -33,6 +34,60 @@ type Config struct {
 	Slack      Slack
 	Webhook    Webhook
 	Xmpp       Xmpp
+	// Holiday calendars in iCalendar format, map of names to file paths.
+	Calendars map[string]string
+	// Profiles of signal settings by their names.
+	Profiles map[string]Profile
+	// Signals expected since start, even when their programs never called.
+	Signals []Signal
+	// Optional TOML file with more [[signals]], e.g. managed separately.
+	SignalsFile string `mapstructure:"signals_file"`
+	// Policy of resolving identity of callers.
+	Identity Identity
+}
+
+// Identity policy config, see api.Identity.
+type Identity struct {
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	Header         string
+	MetaHost       string `mapstructure:"meta_host"`
+	ReverseDNS     bool   `mapstructure:"reverse_dns"`
+}
+
+// Profile of signal settings, see api.Profile.
+type Profile struct {
+	Match      string
+	Notifier   []string
+	NextSignal string `mapstructure:"next_signal"`
+	Grace      string
+	AllClear   bool `mapstructure:"all_clear"`
+	Repeat     string
+	Escalation []EscalationStep
+}
+
+// Signal declared in config, see api.Declared. It is encoded to JSON with fields
+// set in config only, so that they override its profile, e.g. all_clear=false.
+type Signal struct {
+	Name        string            `json:"name"`
+	Profile     string            `json:"profile,omitempty"`
+	Notifier    []string          `json:"notifier,omitempty"`
+	NextSignal  string            `mapstructure:"next_signal" json:"next_signal,omitempty"`
+	Grace       string            `json:"grace,omitempty"`
+	AllClear    *bool             `mapstructure:"all_clear" json:"all_clear,omitempty"`
+	Repeat      string            `json:"repeat,omitempty"`
+	Escalation  []EscalationStep  `json:"escalation,omitempty"`
+	Schedule    string            `json:"schedule,omitempty"`
+	Timezone    string            `json:"timezone,omitempty"`
+	Tolerance   string            `json:"tolerance,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`
+	FirstSignal string            `mapstructure:"first_signal" json:"-"`
+}
+
+// EscalationStep config of a profile or signal.
+type EscalationStep struct {
+	After    string `json:"after"`
+	Notifier string `json:"notifier"`
+	Repeat   string `json:"repeat,omitempty"`
 }
 
 // Stderr notifier config.
@@ -128,7 +183,7 @@ func nannyCheck(nanny string) {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
 	signal := api.Signal{
 		Name:       config.Name,
-		Notifier:   otherNannyNotifier,
+		Notifier:   api.NotifierList{otherNannyNotifier},
 		NextSignal: "1s",
 		AllClear:   false,
 		Meta:       map[string]string{"addr": config.Addr},
@@ -167,11 +222,28 @@ func runAPI() {
 		log.Fatal("Unable to create/load sqlite storage", "dsn", config.StorageDSN, "err", err)
 	}
 	defer closer.Close(store)
+	calendars, err := loadCalendars()
+	if err != nil {
+		log.Fatal("Unable to load holiday calendars", "err", err)
+	}
+	signals, err := loadSignals()
+	if err != nil {
+		log.Fatal("Unable to load declared signals", "err", err)
+	}
 
 	api := api.Server{
 		Name:      config.Name,
 		Notifiers: notifiers,
 		Storage:   store,
+		Calendars: calendars,
+		Profiles:  makeProfiles(),
+		Signals:   signals,
+		Identity: api.Identity{
+			TrustedProxies: config.Identity.TrustedProxies,
+			Header:         config.Identity.Header,
+			MetaHost:       config.Identity.MetaHost,
+			ReverseDNS:     config.Identity.ReverseDNS,
+		},
 	}
 	handler, err := api.Handler()
 	if err != nil {
@@ -276,6 +348,90 @@ func makeNotifiers() (map[string]notifier.Notifier, error) {
 	return notifiers, nil
 }
 
+// makeProfiles creates signal profiles according to config.
+func makeProfiles() []api.Profile {
+	var profiles []api.Profile
+	for name, p := range config.Profiles {
+		profiles = append(profiles, api.Profile{
+			Name:  name,
+			Match: p.Match,
+			Signal: api.Signal{
+				Notifier:   api.NotifierList(p.Notifier),
+				NextSignal: p.NextSignal,
+				Grace:      p.Grace,
+				AllClear:   p.AllClear,
+				Repeat:     p.Repeat,
+				Escalation: makeEscalation(p.Escalation),
+			},
+		})
+	}
+	return profiles
+}
+
+// loadSignals creates declared signals according to config, including the
+// signals file.
+func loadSignals() ([]api.Declared, error) {
+	signals := config.Signals
+	if config.SignalsFile != "" {
+		v := viper.New()
+		v.SetConfigFile(config.SignalsFile)
+		err := v.ReadInConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read signals file")
+		}
+		var file struct {
+			Signals []Signal
+		}
+		err = v.Unmarshal(&file)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to decode signals file")
+		}
+		signals = append(signals, file.Signals...)
+	}
+
+	var declared []api.Declared
+	for _, s := range signals {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to encode signal %s", s.Name)
+		}
+		declared = append(declared, api.Declared{
+			Signal:      data,
+			FirstSignal: s.FirstSignal,
+		})
+	}
+	return declared, nil
+}
+
+// makeEscalation creates escalation steps according to config.
+func makeEscalation(steps []EscalationStep) []api.EscalationStep {
+	var escalation []api.EscalationStep
+	for _, step := range steps {
+		escalation = append(escalation, api.EscalationStep{
+			After:    step.After,
+			Notifier: step.Notifier,
+			Repeat:   step.Repeat,
+		})
+	}
+	return escalation
+}
+
+// loadCalendars loads holiday calendars from config.
+func loadCalendars() (map[string]*calendar.Calendar, error) {
+	calendars := make(map[string]*calendar.Calendar)
+	for name, path := range config.Calendars {
+		c, err := calendar.Load(name, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, skipped := range c.Skipped() {
+			log.Warn("Calendar event is skipped, it is not a holiday.", "calendar", name, "event", skipped)
+		}
+		calendars[name] = c
+	}
+	return calendars, nil
+}
+
 // shutdown handles interrupt signal and shuts down server cleanly, waiting for
 // all idle connections to be closed.
 func shutdown(server *http.Server, idleConnsClosed chan struct{}) {
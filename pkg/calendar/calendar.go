@@ -0,0 +1,290 @@
+// Package calendar parses holiday calendars in iCalendar format (RFC 5545) and
+// tells whether a day is a holiday.
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"nanny/pkg/closer"
+
+	"github.com/pkg/errors"
+)
+
+// Calendar represents parsed holiday calendar. Each event marks whole days as
+// holidays, time of the event is not used.
+type Calendar struct {
+	name string
+
+	days    map[string]bool // Holidays as "2006-01-02".
+	yearly  map[string]bool // Holidays repeated every year as "01-02".
+	skipped []string        // Events with unsupported recurrence.
+}
+
+// rule represents parsed recurrence rule of an event.
+type rule struct {
+	yearly    bool
+	months    []int // BYMONTH, month of the event's start when empty.
+	monthDays []int // BYMONTHDAY, day of the event's start when empty.
+}
+
+// unsupportedError is returned for recurrence rule which is valid, but not
+// supported, its event is skipped.
+type unsupportedError struct {
+	value string
+}
+
+func (e unsupportedError) Error() string {
+	return "unsupported recurrence rule: " + e.value
+}
+
+// Load parses calendar from iCalendar file.
+func Load(name, path string) (*Calendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open calendar %s", name)
+	}
+	defer closer.Close(f)
+	return Parse(name, f)
+}
+
+// Parse parses calendar in iCalendar format. Only DTSTART, DTEND and RRULE of
+// events are used, the only supported recurrence is FREQ=YEARLY, e.g. New Year's
+// Day, optionally with BYMONTH and BYMONTHDAY. Events with other recurrence, e.g.
+// BYDAY, are skipped, see Skipped.
+func Parse(name string, r io.Reader) (*Calendar, error) {
+	c := &Calendar{
+		name:   name,
+		days:   make(map[string]bool),
+		yearly: make(map[string]bool),
+	}
+	lines, numbers, err := unfold(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read calendar %s", name)
+	}
+
+	var (
+		found, inEvent bool
+		start, end     time.Time
+		recurrence     rule
+		skip           string
+	)
+	for i, line := range lines {
+		prop, value := splitLine(line)
+		switch {
+		case prop == "BEGIN" && value == "VCALENDAR":
+			found = true
+		case prop == "BEGIN" && value == "VEVENT":
+			inEvent = true
+			start, end, recurrence, skip = time.Time{}, time.Time{}, rule{}, ""
+		case prop == "END" && value == "VEVENT":
+			if start.IsZero() {
+				return nil, errors.Errorf("invalid calendar %s: event without DTSTART ending on line %d", name, numbers[i])
+			}
+			if skip != "" {
+				c.skipped = append(c.skipped, skip)
+			} else {
+				c.add(start, end, recurrence)
+			}
+			inEvent = false
+		case inEvent && prop == "DTSTART":
+			start, err = parseDate(value, false)
+		case inEvent && prop == "DTEND":
+			end, err = parseDate(value, true)
+		case inEvent && prop == "RRULE":
+			recurrence, err = parseRule(value)
+			if unsupported, ok := err.(unsupportedError); ok {
+				skip = fmt.Sprintf("line %d: %s", numbers[i], unsupported)
+				err = nil
+			}
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid calendar %s on line %d", name, numbers[i])
+		}
+	}
+	if !found {
+		return nil, errors.Errorf("invalid calendar %s: VCALENDAR not found", name)
+	}
+	return c, nil
+}
+
+// String returns name of the calendar.
+func (c *Calendar) String() string {
+	return c.name
+}
+
+// Skipped returns events skipped because of unsupported recurrence, as "line N:
+// reason".
+func (c *Calendar) Skipped() []string {
+	return c.skipped
+}
+
+// Holiday returns true when day of t, in t's location, is a holiday.
+func (c *Calendar) Holiday(t time.Time) bool {
+	return c.days[t.Format("2006-01-02")] || c.yearly[t.Format("01-02")]
+}
+
+// add marks days of event from start until end, exclusive, as holidays, every
+// year on days of the rule when it is yearly. Event without end lasts one day.
+func (c *Calendar) add(start, end time.Time, r rule) {
+	if !r.yearly {
+		c.addDays(start, end, false)
+		return
+	}
+	months, monthDays := r.months, r.monthDays
+	if len(months) == 0 {
+		months = []int{int(start.Month())}
+	}
+	if len(monthDays) == 0 {
+		monthDays = []int{start.Day()}
+	}
+	days := 1
+	if end.After(start) {
+		days = int(end.Sub(start).Hours() / 24)
+	}
+	for _, month := range months {
+		for _, monthDay := range monthDays {
+			// Only month and day are used, leap year includes February 29.
+			day := time.Date(2000, time.Month(month), monthDay, 0, 0, 0, 0, time.UTC)
+			if day.Day() != monthDay {
+				// No such day in the month, e.g. February 30.
+				continue
+			}
+			c.addDays(day, day.AddDate(0, 0, days), true)
+		}
+	}
+}
+
+// addDays marks days from start until end, exclusive, as holidays, repeated every
+// year when yearly. Event without end lasts one day.
+func (c *Calendar) addDays(start, end time.Time, yearly bool) {
+	day := start
+	for {
+		if yearly {
+			c.yearly[day.Format("01-02")] = true
+		} else {
+			c.days[day.Format("2006-01-02")] = true
+		}
+		day = day.AddDate(0, 0, 1)
+		if !day.Before(end) {
+			return
+		}
+	}
+}
+
+// unfold reads content lines, joining lines folded by a leading space or tab.
+// Returns numbers of the lines in the file as well.
+func unfold(r io.Reader) ([]string, []int, error) {
+	var (
+		lines   []string
+		numbers []int
+	)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+		numbers = append(numbers, n)
+	}
+	return lines, numbers, scanner.Err()
+}
+
+// splitLine splits content line "NAME;PARAM=X:VALUE" to upper case property name
+// and value, parameters are ignored.
+func splitLine(line string) (string, string) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", ""
+	}
+	name, value := line[:i], strings.TrimSpace(line[i+1:])
+	if j := strings.Index(name, ";"); j >= 0 {
+		name = name[:j]
+	}
+	return strings.ToUpper(name), value
+}
+
+// parseDate parses DATE "20061225" or DATE-TIME "20061225T120000Z" value as a
+// day. End of the event is exclusive, DATE-TIME end after midnight includes its
+// day.
+func parseDate(value string, end bool) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, errors.Errorf("invalid date: %s", value)
+	}
+	day, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid date: %s", value)
+	}
+	if end && strings.Contains(value, "T") && !strings.HasPrefix(value[8:], "T000000") {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// parseRule parses recurrence rule, only yearly rules are supported, others
+// return unsupportedError.
+func parseRule(value string) (rule, error) {
+	r := rule{}
+	for _, part := range strings.Split(value, ";") {
+		i := strings.Index(part, "=")
+		if i < 0 {
+			return rule{}, errors.Errorf("invalid recurrence rule: %s", value)
+		}
+		name, partValue := strings.ToUpper(part[:i]), strings.ToUpper(part[i+1:])
+		var err error
+		switch name {
+		case "FREQ":
+			if partValue != "YEARLY" {
+				return rule{}, unsupportedError{value}
+			}
+			r.yearly = true
+		case "INTERVAL":
+			if partValue != "1" {
+				return rule{}, unsupportedError{value}
+			}
+		case "WKST":
+			// Start of week does not change yearly dates.
+		case "BYMONTH":
+			r.months, err = parseNumbers(partValue, 12)
+		case "BYMONTHDAY":
+			r.monthDays, err = parseNumbers(partValue, 31)
+		default:
+			// E.g. BYDAY, COUNT or UNTIL.
+			return rule{}, unsupportedError{value}
+		}
+		if err != nil {
+			if _, ok := err.(unsupportedError); ok {
+				return rule{}, unsupportedError{value}
+			}
+			return rule{}, errors.Wrapf(err, "invalid recurrence rule: %s", value)
+		}
+	}
+	if !r.yearly {
+		return rule{}, errors.Errorf("invalid recurrence rule without FREQ: %s", value)
+	}
+	return r, nil
+}
+
+// parseNumbers parses comma separated list of numbers from 1 to max. Negative
+// numbers, counted from the end, are not supported.
+func parseNumbers(value string, max int) ([]int, error) {
+	var numbers []int
+	for _, field := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(field)
+		switch {
+		case err != nil || n == 0 || n > max || n < -max:
+			return nil, errors.Errorf("invalid number: %s", field)
+		case n < 0:
+			return nil, unsupportedError{value}
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, nil
+}
@@ -0,0 +1,100 @@
+package calendar_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"nanny/pkg/calendar"
+)
+
+const holidays = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Nanny//Holidays//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:new-year@nanny\r\n" +
+	"DTSTART;VALUE=DATE:20200101\r\n" +
+	"RRULE:FREQ=YEARLY\r\n" +
+	"SUMMARY:New Year's\r\n" +
+	"  Day\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:easter@nanny\r\n" +
+	"DTSTART;VALUE=DATE:20260403\r\n" +
+	"DTEND;VALUE=DATE:20260407\r\n" +
+	"SUMMARY:Easter\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:outage@nanny\r\n" +
+	"DTSTART:20261116T080000Z\r\n" +
+	"DTEND:20261117T120000Z\r\n" +
+	"SUMMARY:Company day\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:christmas@nanny\r\n" +
+	"DTSTART;VALUE=DATE:20201224\r\n" +
+	"RRULE:FREQ=YEARLY;WKST=MO;BYMONTH=12;BYMONTHDAY=24,25,26\r\n" +
+	"SUMMARY:Christmas\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:thanksgiving@nanny\r\n" +
+	"DTSTART;VALUE=DATE:20201126\r\n" +
+	"RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=4TH\r\n" +
+	"SUMMARY:Thanksgiving\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	c, err := calendar.Parse("czech", strings.NewReader(holidays))
+	if err != nil {
+		t.Fatalf("calendar.Parse should not return error, got: %v", err)
+	}
+	if c.String() != "czech" {
+		t.Errorf("calendar should be named czech, got: %s", c)
+	}
+	for _, test := range []struct {
+		day     time.Time
+		holiday bool
+	}{
+		{time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC), true},
+		{time.Date(2031, 1, 1, 23, 59, 0, 0, time.UTC), true},
+		{time.Date(2031, 1, 2, 0, 0, 0, 0, time.UTC), false},
+		{time.Date(2026, 4, 2, 12, 0, 0, 0, time.UTC), false},
+		{time.Date(2026, 4, 3, 12, 0, 0, 0, time.UTC), true},
+		{time.Date(2026, 4, 6, 12, 0, 0, 0, time.UTC), true},
+		{time.Date(2026, 4, 7, 12, 0, 0, 0, time.UTC), false},
+		{time.Date(2027, 4, 3, 12, 0, 0, 0, time.UTC), false},
+		{time.Date(2026, 11, 16, 12, 0, 0, 0, time.UTC), true},
+		{time.Date(2026, 11, 17, 12, 0, 0, 0, time.UTC), true},
+		{time.Date(2026, 11, 18, 12, 0, 0, 0, time.UTC), false},
+		{time.Date(2030, 12, 23, 12, 0, 0, 0, time.UTC), false},
+		{time.Date(2030, 12, 24, 12, 0, 0, 0, time.UTC), true},
+		{time.Date(2030, 12, 26, 12, 0, 0, 0, time.UTC), true},
+		{time.Date(2030, 12, 27, 12, 0, 0, 0, time.UTC), false},
+		{time.Date(2020, 11, 26, 12, 0, 0, 0, time.UTC), false},
+	} {
+		if got := c.Holiday(test.day); got != test.holiday {
+			t.Errorf("Holiday(%s) should be %t, got: %t", test.day, test.holiday, got)
+		}
+	}
+	skipped := c.Skipped()
+	if len(skipped) != 1 || skipped[0] != "line 32: unsupported recurrence rule: FREQ=YEARLY;BYMONTH=11;BYDAY=4TH" {
+		t.Errorf("event with unsupported recurrence should be skipped, got: %v", skipped)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, ical := range []string{
+		"",
+		"BEGIN:VEVENT\nDTSTART:20200101\nEND:VEVENT\n",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:no start\nEND:VEVENT\nEND:VCALENDAR\n",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:2020\nEND:VEVENT\nEND:VCALENDAR\n",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20200101\nRRULE:FREQ=YEARLY;BYMONTH=13\nEND:VEVENT\nEND:VCALENDAR\n",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20200101\nRRULE:YEARLY\nEND:VEVENT\nEND:VCALENDAR\n",
+	} {
+		_, err := calendar.Parse("invalid", strings.NewReader(ical))
+		if err == nil {
+			t.Errorf("calendar.Parse(%q) should return error", ical)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Package cron parses standard five field cron expressions and computes times
+// matching them.
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule represents parsed cron expression.
+type Schedule struct {
+	expr string
+
+	// Bit sets of matching values.
+	minute, hour, dom, month, dow uint64
+	// Day of month and day of week are matched with OR when both are restricted.
+	domStar, dowStar bool
+}
+
+// field describes allowed values of one cron field.
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Sunday may be written as 0 or 7.
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors are shortcuts for common expressions.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses cron expression with five fields: minute, hour, day of month,
+// month and day of week. Fields may contain "*", values, ranges "1-5", lists
+// "1,3,5" and steps "*/15" or "0-30/10". Months and days of week may be written
+// as names, "jan" or "mon". Descriptors like "@daily" are supported as well.
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if d, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("invalid cron expression %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	// Day field starting with star, e.g. "*/2", is not restricted, like in cron.
+	s := &Schedule{
+		expr:    expr,
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	var err error
+	for i, f := range []struct {
+		bits  *uint64
+		field field
+	}{
+		{&s.minute, minuteField},
+		{&s.hour, hourField},
+		{&s.dom, domField},
+		{&s.month, monthField},
+		{&s.dow, dowField},
+	} {
+		*f.bits, err = parseField(fields[i], f.field)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cron expression %q", expr)
+		}
+	}
+	// Sunday is 0 in time.Weekday.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// String returns the original expression.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first time matching the schedule strictly after t, in t's
+// location. Zero time is returned when there is no such time within 5 years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			// Absolute time is used so that DST changes cannot move us back.
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Prev returns the last time matching the schedule at or before t, looking back
+// at most within. Zero time is returned when there is no such time.
+func (s *Schedule) Prev(t time.Time, within time.Duration) time.Time {
+	from := t.Add(-within)
+	var prev time.Time
+	for next := s.Next(from.Add(-time.Nanosecond)); !next.IsZero() && !next.After(t); next = s.Next(next) {
+		prev = next
+	}
+	return prev
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// parseField parses comma separated list of ranges into a bit set.
+func parseField(value string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(value, ",") {
+		b, err := parseRange(part, f)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+// parseRange parses "*", "5", "1-5" with optional step "/2".
+func parseRange(value string, f field) (uint64, error) {
+	rangePart, step := value, 1
+	if i := strings.Index(value, "/"); i >= 0 {
+		var err error
+		rangePart = value[:i]
+		step, err = strconv.Atoi(value[i+1:])
+		if err != nil || step <= 0 {
+			return 0, errors.Errorf("invalid step in %s field: %s", f.name, value)
+		}
+	}
+
+	var start, end int
+	switch {
+	case rangePart == "*":
+		start, end = f.min, f.max
+		if f.name == dowField.name {
+			end = 6
+		}
+	case strings.Contains(rangePart, "-"):
+		bounds := strings.SplitN(rangePart, "-", 2)
+		var err error
+		if start, err = parseValue(bounds[0], f); err != nil {
+			return 0, err
+		}
+		if end, err = parseValue(bounds[1], f); err != nil {
+			return 0, err
+		}
+		if start > end {
+			return 0, errors.Errorf("invalid range in %s field: %s", f.name, value)
+		}
+	default:
+		var err error
+		if start, err = parseValue(rangePart, f); err != nil {
+			return 0, err
+		}
+		end = start
+		// "5/10" means from 5 to the end with step 10.
+		if step > 1 {
+			end = f.max
+		}
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << uint(i)
+	}
+	return bits, nil
+}
+
+func parseValue(value string, f field) (int, error) {
+	if n, ok := f.names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < f.min || n > f.max {
+		return 0, errors.Errorf("invalid value in %s field: %s", f.name, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,81 @@
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"nanny/pkg/cron"
+)
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		_, err := cron.Parse(expr)
+		if err == nil {
+			t.Errorf("cron.Parse(%q) should return error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	for _, test := range []struct {
+		expr     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2020, 1, 1, 10, 0, 30, 0, time.UTC), time.Date(2020, 1, 1, 10, 1, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC), time.Date(2020, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC), time.Date(2020, 1, 2, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2020, 1, 31, 10, 0, 0, 0, time.UTC), time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2020, 1, 3, 10, 0, 0, 0, time.UTC), time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2020, 1, 3, 10, 0, 0, 0, time.UTC), time.Date(2020, 1, 5, 9, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Day of month OR day of week when both are restricted.
+		{"0 0 13 * fri", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)},
+		// Day field starting with star is not restricted, both must match.
+		{"0 0 */2 * fri", time.Date(2020, 1, 3, 1, 0, 0, 0, time.UTC), time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * */2", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 2, 13, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC), time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		// 02:30 does not exist on 2020-03-29 in Prague.
+		{"30 2 * * *", time.Date(2020, 3, 28, 12, 0, 0, 0, prague), time.Date(2020, 3, 30, 2, 30, 0, 0, prague)},
+		{"0 3 * * *", time.Date(2020, 10, 24, 12, 0, 0, 0, prague), time.Date(2020, 10, 25, 3, 0, 0, 0, prague)},
+	} {
+		s, err := cron.Parse(test.expr)
+		if err != nil {
+			t.Errorf("cron.Parse(%q) should not return error, got: %v", test.expr, err)
+			continue
+		}
+		got := s.Next(test.from)
+		if !got.Equal(test.expected) {
+			t.Errorf("%q.Next(%s) expected: %s, got: %s", test.expr, test.from, test.expected, got)
+		}
+	}
+}
+
+func TestPrev(t *testing.T) {
+	s, err := cron.Parse("0 2 * * *")
+	if err != nil {
+		t.Fatalf("cron.Parse should not return error, got: %v", err)
+	}
+	now := time.Date(2020, 1, 2, 3, 0, 0, 0, time.UTC)
+	if got := s.Prev(now, 24*time.Hour); !got.Equal(time.Date(2020, 1, 2, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("Prev should return the last matching time, got: %s", got)
+	}
+	if got := s.Prev(now, time.Hour/2); !got.IsZero() {
+		t.Errorf("Prev should return zero time when nothing matches, got: %s", got)
+	}
+}
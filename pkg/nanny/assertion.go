@@ -0,0 +1,110 @@
+package nanny
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"nanny/pkg/notifier"
+
+	"github.com/pkg/errors"
+)
+
+// Assertion is a check of a numeric value reported by the program, e.g.
+// "records > 0". Signal whose values fail any of its assertions notifies right
+// away instead of resetting the timer.
+type Assertion struct {
+	Value     string  // Name of the checked value, e.g. "records".
+	Operator  string  // One of <, <=, >, >=, == and !=.
+	Threshold float64 // Value is compared to the threshold.
+}
+
+var assertionRegexp = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*(<=|>=|==|!=|<|>)\s*(\S+)\s*$`)
+
+// ParseAssertion parses assertion in form "<value> <operator> <threshold>", e.g.
+// "records > 0" or "errors < 5".
+func ParseAssertion(s string) (Assertion, error) {
+	var a Assertion
+	match := assertionRegexp.FindStringSubmatch(s)
+	if match == nil {
+		return a, errors.Errorf("invalid assertion %q, expected e.g. \"records > 0\"", s)
+	}
+	threshold, err := strconv.ParseFloat(match[3], 64)
+	if err != nil {
+		return a, errors.Errorf("invalid threshold of assertion %q", s)
+	}
+	a.Value = match[1]
+	a.Operator = match[2]
+	a.Threshold = threshold
+	return a, nil
+}
+
+// String returns the assertion in the form accepted by ParseAssertion.
+func (a Assertion) String() string {
+	return fmt.Sprintf("%s %s %s", a.Value, a.Operator, strconv.FormatFloat(a.Threshold, 'g', -1, 64))
+}
+
+// holds returns true if given value satisfies the assertion.
+func (a Assertion) holds(value float64) bool {
+	switch a.Operator {
+	case "<":
+		return value < a.Threshold
+	case "<=":
+		return value <= a.Threshold
+	case ">":
+		return value > a.Threshold
+	case ">=":
+		return value >= a.Threshold
+	case "==":
+		return value == a.Threshold
+	case "!=":
+		return value != a.Threshold
+	}
+	return false
+}
+
+// validate checks the assertion is complete, e.g. when it was not parsed.
+func (a Assertion) validate() error {
+	if a.Value == "" {
+		return errors.New("value is empty")
+	}
+	if _, err := ParseAssertion(a.String()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// failedAssertion checks given values and returns description of the first
+// failed assertion, e.g. "records = 0, expected records > 0". Empty string is
+// returned when all assertions hold, or when there are no values, e.g. signal of
+// finished run. Missing value fails the assertion.
+func (s validSignal) failedAssertion(values map[string]float64) string {
+	if values == nil {
+		return ""
+	}
+	for _, a := range s.Assertions {
+		value, ok := values[a.Value]
+		if !ok {
+			return fmt.Sprintf("%s was not reported, expected %s", a.Value, a)
+		}
+		if !a.holds(value) {
+			return fmt.Sprintf("%s = %s, expected %s", a.Value, strconv.FormatFloat(value, 'g', -1, 64), a)
+		}
+	}
+	return ""
+}
+
+// failAssertion reports signal which failed an assertion like a failure of the
+// program, user is notified immediately, see Fail. The next signal is expected
+// as usual. Must be called with nt.lock held, which is released.
+func (nt *Timer) failAssertion(now time.Time, failed string) {
+	first := nt.status.State != StateAlerting
+	nt.status.LastSignal = now
+	nt.status.Assertion = failed
+	nt.watch(now)
+
+	nt.timer.Stop()
+	nt.alert(notifier.KindAssertion)
+	nt.notify(now, first)
+}
@@ -0,0 +1,109 @@
+package nanny
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// registerDependencies records dependencies of the signal, returns error if they
+// would create a cycle. Signals which are not registered yet may be depended on.
+// The check runs only when dependencies change, it is atomic with the record, so
+// that concurrent signals can not create a cycle together.
+func (n *Nanny) registerDependencies(s validSignal) error {
+	n.depsLock.Lock()
+	defer n.depsLock.Unlock()
+	if sameNames(n.deps[s.Name], s.DependsOn) {
+		return nil
+	}
+
+	// Depth-first search from the signal's dependencies back to the signal.
+	visited := make(map[string]bool)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		path = append(path, name)
+		if name == s.Name {
+			return errors.Errorf("signal.DependsOn creates a cycle: %v", path)
+		}
+		if visited[name] {
+			return nil
+		}
+		visited[name] = true
+		for _, parent := range n.deps[name] {
+			if err := visit(parent, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, parent := range s.DependsOn {
+		if err := visit(parent, []string{s.Name}); err != nil {
+			return err
+		}
+	}
+
+	if len(s.DependsOn) == 0 {
+		delete(n.deps, s.Name)
+		return nil
+	}
+	if n.deps == nil {
+		n.deps = make(map[string][]string)
+	}
+	n.deps[s.Name] = append([]string(nil), s.DependsOn...)
+	return nil
+}
+
+// unregisterDependencies forgets dependencies of removed signal.
+func (n *Nanny) unregisterDependencies(name string) {
+	n.depsLock.Lock()
+	delete(n.deps, name)
+	n.depsLock.Unlock()
+}
+
+// sameNames returns true when both lists contain the same names in the same
+// order.
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// alertingDependency returns name of the first alerting signal the given signal
+// depends on, or empty string.
+func (n *Nanny) alertingDependency(s Signal) string {
+	for _, name := range s.DependsOn {
+		timer := n.GetTimer(name)
+		if timer != nil && timer.isAlerting() {
+			return name
+		}
+	}
+	return ""
+}
+
+// heldBy returns names of signals whose alerts are held back because given signal
+// is alerting.
+func (n *Nanny) heldBy(parent string) []string {
+	var names []string
+	for item := range n.held.Iter() {
+		if item.Value.(string) == parent {
+			names = append(names, item.Key.(string))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// recheckSuppressed wakes timers with suppressed notifications, so that they
+// notify when their silence was removed or their dependency is not alerting
+// anymore.
+func (n *Nanny) recheckSuppressed() {
+	for _, timer := range n.GetTimers() {
+		timer.recheck()
+	}
+}
@@ -0,0 +1,70 @@
+package nanny
+
+import (
+	"time"
+
+	"nanny/pkg/notifier"
+)
+
+// transition records change between alerting and recovered state and returns true
+// when the timer started flapping because of it. Must be called with nt.lock held.
+func (nt *Timer) transition(now time.Time) bool {
+	if nt.signal.FlapThreshold == 0 {
+		return false
+	}
+	nt.flapping(now)
+	nt.status.Transitions = append(nt.status.Transitions, now)
+	if nt.status.Flapping || len(nt.status.Transitions) < nt.signal.FlapThreshold {
+		return false
+	}
+	nt.status.Flapping = true
+	return true
+}
+
+// flapping forgets transitions older than FlapWindow and returns whether the
+// timer is still flapping. Flapping ends when there was no transition within the
+// window. Must be called with nt.lock held.
+func (nt *Timer) flapping(now time.Time) bool {
+	since := now.Add(-nt.signal.FlapWindow)
+	i := 0
+	for i < len(nt.status.Transitions) && !nt.status.Transitions[i].After(since) {
+		i++
+	}
+	nt.status.Transitions = nt.status.Transitions[i:]
+	if len(nt.status.Transitions) == 0 {
+		nt.status.Transitions = nil
+		nt.status.Flapping = false
+	}
+	return nt.status.Flapping
+}
+
+// flapEnd returns when flapping ends if there is no other transition. Must be
+// called with nt.lock held.
+func (nt *Timer) flapEnd() time.Time {
+	last := nt.status.Transitions[len(nt.status.Transitions)-1]
+	return last.Add(nt.signal.FlapWindow)
+}
+
+// flapMessage returns notification about flapping timer. Must be called with
+// nt.lock held.
+func (nt *Timer) flapMessage() notifier.Message {
+	msg := nt.message()
+	msg.Kind = notifier.KindFlapping
+	msg.NextSignal = nt.signal.FlapWindow
+	msg.Changes = len(nt.status.Transitions)
+	msg.Reminder = 0
+	msg.Dependents = nil
+	return msg
+}
+
+// stable returns true when the recovered timer signalled StablePings times or
+// for StableFor, so that all-clear may be sent. Without these rules the timer is
+// stable right away. Must be called with nt.lock held.
+func (nt *Timer) stable(now time.Time) bool {
+	pings, duration := nt.signal.StablePings, nt.signal.StableFor
+	if pings == 0 && duration == 0 {
+		return true
+	}
+	return (pings > 0 && nt.status.Pings >= pings) ||
+		(duration > 0 && !now.Before(nt.status.StableSince.Add(duration)))
+}
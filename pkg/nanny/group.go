@@ -0,0 +1,307 @@
+package nanny
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"nanny/pkg/notifier"
+
+	"github.com/pkg/errors"
+)
+
+// Group represents a quorum group of signals, e.g. replicas of horizontally scaled
+// service. The group notifies when fewer than MinAlive of its members are alive,
+// members which stop calling do not notify on their own.
+type Group struct {
+	Name string
+	// Members are signals whose name starts with Prefix and whose meta contains
+	// all of Meta. At least one of them must be set.
+	Prefix   string
+	Meta     map[string]string
+	MinAlive int               // Minimum number of alive members.
+	Notifier notifier.Notifier // What notifier to use.
+	// Optional additional notifiers, each of them is notified independently.
+	Notifiers []notifier.Notifier
+	AllClear  bool // Activate optional all-clear notification
+}
+
+// GroupStatus represents lifecycle of a group. Only StateWaiting, StateAlerting
+// and StateRecovered are used.
+type GroupStatus struct {
+	State       State
+	Alive       int // Number of alive members, see Quorum.check.
+	Members     int // Number of all members.
+	AlertedAt   time.Time
+	RecoveredAt time.Time
+}
+
+// Quorum watches members of a group.
+type Quorum struct {
+	group  Group // Never modified, AddGroup replaces the whole quorum.
+	nanny  *Nanny
+	status GroupStatus
+	// Closed when the last notification is delivered, see check.
+	delivered chan struct{}
+
+	lock sync.Mutex
+}
+
+// MarshalJSON marshals a nanny.Quorum into JSON. Fields name, prefix, meta, min_alive,
+// notifier, notifiers, all_clear, state, alive, members, alerted_at and recovered_at
+// are exported.
+func (q *Quorum) MarshalJSON() ([]byte, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var notifiers []string
+	if len(q.group.Notifiers) > 0 {
+		notifiers = append(notifiers, q.group.Notifier.String())
+		for _, notif := range q.group.Notifiers {
+			notifiers = append(notifiers, notif.String())
+		}
+	}
+	return json.Marshal(&struct {
+		Name        string            `json:"name"`
+		Prefix      string            `json:"prefix,omitempty"`
+		Meta        map[string]string `json:"meta,omitempty"`
+		MinAlive    int               `json:"min_alive"`
+		Notifier    string            `json:"notifier"`
+		Notifiers   []string          `json:"notifiers,omitempty"`
+		AllClear    bool              `json:"all_clear"`
+		State       State             `json:"state"`
+		Alive       int               `json:"alive"`
+		Members     int               `json:"members"`
+		AlertedAt   string            `json:"alerted_at,omitempty"`
+		RecoveredAt string            `json:"recovered_at,omitempty"`
+	}{
+		Name:        q.group.Name,
+		Prefix:      q.group.Prefix,
+		Meta:        q.group.Meta,
+		MinAlive:    q.group.MinAlive,
+		Notifier:    q.group.Notifier.String(),
+		Notifiers:   notifiers,
+		AllClear:    q.group.AllClear,
+		State:       q.status.State,
+		Alive:       q.status.Alive,
+		Members:     q.status.Members,
+		AlertedAt:   formatTime(q.status.AlertedAt),
+		RecoveredAt: formatTime(q.status.RecoveredAt),
+	})
+}
+
+// Group returns the group watched by the quorum.
+func (q *Quorum) Group() Group {
+	return q.group
+}
+
+// Status returns snapshot of the group's lifecycle.
+func (q *Quorum) Status() GroupStatus {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.status
+}
+
+// Matches returns true if the signal is a member of the group.
+func (g *Group) Matches(signal Signal) bool {
+	if !strings.HasPrefix(signal.Name, g.Prefix) {
+		return false
+	}
+	for key, value := range g.Meta {
+		if v, ok := signal.Meta[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// validateGroup does simple sanity check.
+func validateGroup(g Group) error {
+	if g.Name == "" {
+		return errors.New("group.Name is empty")
+	}
+	if g.Prefix == "" && len(g.Meta) == 0 {
+		return errors.New("group.Prefix or group.Meta must be set")
+	}
+	if g.MinAlive <= 0 {
+		return errors.New("group.MinAlive must be positive")
+	}
+	if g.Notifier == nil {
+		return errors.New("group.Notifier is nil")
+	}
+	return nil
+}
+
+// AddGroup adds new group, or replaces existing group with the same name. The
+// group notifies right away if fewer than MinAlive members are alive.
+func (n *Nanny) AddGroup(g Group) error {
+	var status GroupStatus
+	if q := n.GetQuorum(g.Name); q != nil {
+		status = q.Status()
+	}
+	return n.RestoreGroup(g, status)
+}
+
+// RestoreGroup adds group in previously persisted state, see Quorum.Status. It is
+// used to load groups after restart, so that alerting groups do not notify again.
+func (n *Nanny) RestoreGroup(g Group, status GroupStatus) error {
+	err := validateGroup(g)
+	if err != nil {
+		return errors.Wrap(err, "group is invalid")
+	}
+	if status.State == "" {
+		status.State = StateWaiting
+	}
+	q := &Quorum{
+		group:  g,
+		nanny:  n,
+		status: status,
+	}
+	n.groups.Set(g.Name, q)
+	q.check()
+	// Members held back by the replaced group may alert now.
+	n.recheckSuppressed()
+	return nil
+}
+
+// RemoveGroup removes group with given name, its members notify on their own
+// again. Returns false if there is no such group.
+func (n *Nanny) RemoveGroup(name string) bool {
+	if _, ok := n.groups.GetStringKey(name); !ok {
+		return false
+	}
+	n.groups.Del(name)
+	n.recheckSuppressed()
+	return true
+}
+
+// GetQuorum returns quorum of group with given name or nil.
+func (n *Nanny) GetQuorum(name string) *Quorum {
+	value, ok := n.groups.GetStringKey(name)
+	if !ok {
+		return nil
+	}
+	return value.(*Quorum)
+}
+
+// GetQuorums returns quorums of all groups, ordered by name.
+func (n *Nanny) GetQuorums() []*Quorum {
+	var quorums []*Quorum
+	for item := range n.groups.Iter() {
+		quorums = append(quorums, item.Value.(*Quorum))
+	}
+	sort.Slice(quorums, func(i, j int) bool {
+		return quorums[i].group.Name < quorums[j].group.Name
+	})
+	return quorums
+}
+
+// groupOf returns name of the first group the signal is a member of, or empty
+// string.
+func (n *Nanny) groupOf(s Signal) string {
+	for _, q := range n.GetQuorums() {
+		if q.group.Matches(s) {
+			return q.group.Name
+		}
+	}
+	return ""
+}
+
+// checkQuorums checks all groups after their members changed.
+func (n *Nanny) checkQuorums() {
+	for item := range n.groups.Iter() {
+		item.Value.(*Quorum).check()
+	}
+}
+
+// check counts alive members and notifies when the group lost or regained its
+// quorum. Members are alive unless they are alerting or paused. Group without
+// members does not notify, there is nothing to watch yet.
+func (q *Quorum) check() {
+	q.lock.Lock()
+	alive, members := 0, 0
+	for _, timer := range q.nanny.GetTimers() {
+		if !q.group.Matches(timer.Signal()) {
+			continue
+		}
+		members++
+		switch timer.State() {
+		case StateAlerting, StatePaused:
+		default:
+			alive++
+		}
+	}
+
+	now := time.Now()
+	previous := q.status
+	q.status.Alive = alive
+	q.status.Members = members
+
+	var (
+		notifiers []notifier.Notifier
+		allClear  bool
+	)
+	switch {
+	case alive < q.group.MinAlive && members > 0 && q.status.State != StateAlerting:
+		q.status.State = StateAlerting
+		q.status.AlertedAt = now
+		notifiers = q.notifiers()
+	case alive >= q.group.MinAlive && q.status.State == StateAlerting:
+		q.status.State = StateRecovered
+		q.status.RecoveredAt = now
+		if q.group.AllClear {
+			notifiers = q.notifiers()
+			allClear = true
+		}
+	}
+	status := q.status
+	msg := q.message()
+	if len(notifiers) > 0 {
+		// Notifications are delivered in the background, the check runs on every
+		// change of members, e.g. their signals. They are delivered in order,
+		// each one waits for the previous one.
+		previous, delivered := q.delivered, make(chan struct{})
+		q.delivered = delivered
+		go func() {
+			if previous != nil {
+				<-previous
+			}
+			q.nanny.deliver("group: "+q.group.Name, notifiers, func(notif notifier.Notifier) error {
+				if allClear {
+					return notif.NotifyAllClear(msg)
+				}
+				return notif.Notify(msg)
+			})
+			close(delivered)
+		}()
+	}
+	q.lock.Unlock()
+
+	if status != previous && q.nanny.QuorumChangeFunc != nil {
+		q.nanny.QuorumChangeFunc(q)
+	}
+}
+
+// notifiers returns all of the group's notifiers.
+func (q *Quorum) notifiers() []notifier.Notifier {
+	return append([]notifier.Notifier{q.group.Notifier}, q.group.Notifiers...)
+}
+
+// message must be called with q.lock held.
+func (q *Quorum) message() notifier.Message {
+	name := "Nanny"
+	if q.nanny.Name != "" {
+		name = q.nanny.Name
+	}
+	return notifier.Message{
+		Nanny:    name,
+		Program:  q.group.Name,
+		Kind:     notifier.KindQuorum,
+		Alive:    q.status.Alive,
+		Members:  q.status.Members,
+		MinAlive: q.group.MinAlive,
+		Meta:     q.group.Meta,
+	}
+}
@@ -0,0 +1,129 @@
+package nanny
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// RunHistory is how many runtimes of finished runs are kept for anomaly
+	// detection and statistics.
+	RunHistory = 100
+	// minRunHistory is how many finished runs are needed to detect anomalies.
+	minRunHistory = 5
+)
+
+// RunStats are statistics of runtimes of the last finished runs, see RunHistory.
+type RunStats struct {
+	Runs   int
+	Last   time.Duration
+	Min    time.Duration
+	Mean   time.Duration
+	Median time.Duration
+	P95    time.Duration // 95th percentile.
+	Max    time.Duration
+	// Runtime after which the current run is anomalous, zero when anomaly
+	// detection is not enabled or there are too few runs.
+	AnomalyAfter time.Duration
+}
+
+// MarshalJSON marshals RunStats into JSON, durations are formatted like
+// "1m30s", empty when there are no runs.
+func (s RunStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Runs         int    `json:"runs"`
+		Last         string `json:"last,omitempty"`
+		Min          string `json:"min,omitempty"`
+		Mean         string `json:"mean,omitempty"`
+		Median       string `json:"median,omitempty"`
+		P95          string `json:"p95,omitempty"`
+		Max          string `json:"max,omitempty"`
+		AnomalyAfter string `json:"anomaly_after,omitempty"`
+	}{
+		Runs:         s.Runs,
+		Last:         formatDuration(s.Last),
+		Min:          formatDuration(s.Min),
+		Mean:         formatDuration(s.Mean),
+		Median:       formatDuration(s.Median),
+		P95:          formatDuration(s.P95),
+		Max:          formatDuration(s.Max),
+		AnomalyAfter: formatDuration(s.AnomalyAfter),
+	})
+}
+
+// RunStats returns statistics of runtimes of the last finished runs.
+func (nt *Timer) RunStats() RunStats {
+	nt.lock.Lock()
+	defer nt.lock.Unlock()
+
+	runtimes := nt.status.Runtimes
+	stats := RunStats{
+		Runs:         len(runtimes),
+		AnomalyAfter: nt.anomalyAfter(),
+	}
+	if len(runtimes) == 0 {
+		return stats
+	}
+	sorted := sortDurations(runtimes)
+	var total time.Duration
+	for _, runtime := range runtimes {
+		total += runtime
+	}
+	stats.Last = runtimes[len(runtimes)-1]
+	stats.Min = sorted[0]
+	stats.Mean = total / time.Duration(len(runtimes))
+	stats.Median = percentile(sorted, 0.5)
+	stats.P95 = percentile(sorted, 0.95)
+	stats.Max = sorted[len(sorted)-1]
+	return stats
+}
+
+// recordRuntime remembers runtime of finished run, only RunHistory of them are
+// kept. Must be called with nt.lock held.
+func (nt *Timer) recordRuntime(runtime time.Duration) {
+	nt.status.Runtimes = append(nt.status.Runtimes, runtime)
+	if len(nt.status.Runtimes) > RunHistory {
+		nt.status.Runtimes = nt.status.Runtimes[len(nt.status.Runtimes)-RunHistory:]
+	}
+}
+
+// anomalyAfter returns runtime after which a run is anomalous, RuntimeFactor
+// times the 95th percentile of previous runtimes. Zero is returned when anomaly
+// detection is not enabled or there are too few runs. Must be called with
+// nt.lock held.
+func (nt *Timer) anomalyAfter() time.Duration {
+	if nt.signal.RuntimeFactor == 0 || len(nt.status.Runtimes) < minRunHistory {
+		return 0
+	}
+	p95 := percentile(sortDurations(nt.status.Runtimes), 0.95)
+	return time.Duration(nt.signal.RuntimeFactor * float64(p95))
+}
+
+// anomalyDeadline returns when the current run becomes anomalous, or zero time.
+// Must be called with nt.lock held.
+func (nt *Timer) anomalyDeadline() time.Time {
+	after := nt.anomalyAfter()
+	if after == 0 || nt.status.RunStarted.IsZero() {
+		return time.Time{}
+	}
+	return nt.status.RunStarted.Add(after)
+}
+
+// sortDurations returns sorted copy of durations.
+func sortDurations(durations []time.Duration) []time.Duration {
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,32 @@
+package nanny
+
+import (
+	"time"
+
+	"nanny/pkg/notifier"
+)
+
+// trip handles signal of inverse timer, user is notified unless the timer is
+// cooling down after previous signal. Must be called with nt.lock held, which is
+// released.
+func (nt *Timer) trip(now time.Time) {
+	nt.status.LastSignal = now
+	nt.timer.Stop()
+	if nt.status.State != StateAlerting {
+		nt.alert(notifier.KindTripped)
+		nt.notify(now, true)
+		return
+	}
+
+	// The cool-down starts again.
+	if nt.status.AlertedAt.IsZero() {
+		// Nobody was notified yet, check whether the notification is still
+		// suppressed.
+		nt.wake(now)
+	} else {
+		nt.schedule()
+	}
+	nt.lock.Unlock()
+
+	nt.nanny.changed(nt)
+}
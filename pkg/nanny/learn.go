@@ -0,0 +1,108 @@
+package nanny
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// adaptive returns true when the timer learns its interval from signals, see
+// Signal.LearnPings. Must be called with nt.lock held.
+func (nt *Timer) adaptive() bool {
+	return nt.signal.LearnPings > 0 && nt.signal.NextSignal == 0
+}
+
+// learning returns true when adaptive timer did not learn its interval yet and
+// does not expect any signal. Must be called with nt.lock held.
+func (nt *Timer) learning() bool {
+	return nt.adaptive() && nt.status.LearnedInterval == 0
+}
+
+// interval returns when the next signal is expected after the last one, the
+// learned interval is used when the signal does not set it. Interval of program
+// which never called is the current one. Must be called with nt.lock held.
+func (nt *Timer) interval() time.Duration {
+	if nt.adaptive() {
+		return nt.status.LearnedInterval
+	}
+	if nt.status.LastSignal.IsZero() {
+		return nt.signal.intervalAt(time.Now())
+	}
+	return nt.signal.intervalAt(nt.status.LastSignal)
+}
+
+// grace returns grace period of the signal, the learned tolerance is used when
+// the signal learns its interval and does not set grace period. Must be called
+// with nt.lock held.
+func (nt *Timer) grace() time.Duration {
+	if nt.adaptive() && nt.signal.Grace == 0 {
+		return nt.status.LearnedGrace
+	}
+	return nt.signal.Grace
+}
+
+// learn records interval between the last signal and a signal received now.
+// Once there are enough of them, expected interval is their median and the
+// tolerance is three times their median absolute deviation, at least a tenth of
+// the interval. Must be called with nt.lock held, before LastSignal is updated.
+func (nt *Timer) learn(now time.Time) {
+	if !nt.learning() || nt.status.LastSignal.IsZero() {
+		return
+	}
+	nt.status.Intervals = append(nt.status.Intervals, now.Sub(nt.status.LastSignal))
+	if len(nt.status.Intervals) < nt.signal.LearnPings-1 {
+		return
+	}
+
+	median := percentile(sortDurations(nt.status.Intervals), 0.5)
+	deviations := make([]time.Duration, len(nt.status.Intervals))
+	for i, interval := range nt.status.Intervals {
+		deviation := interval - median
+		if deviation < 0 {
+			deviation = -deviation
+		}
+		deviations[i] = deviation
+	}
+	tolerance := 3 * percentile(sortDurations(deviations), 0.5)
+	if tolerance < median/10 {
+		tolerance = median / 10
+	}
+	nt.status.LearnedInterval = median
+	nt.status.LearnedGrace = tolerance
+	nt.status.Intervals = nil
+}
+
+// SetInterval overrides learned interval and tolerance of the signal, see
+// Signal.LearnPings. Zero interval starts learning again. Returns error when the
+// signal does not learn its interval.
+func (nt *Timer) SetInterval(interval, grace time.Duration) error {
+	nt.lock.Lock()
+	if !nt.adaptive() {
+		nt.lock.Unlock()
+		return errors.New("signal does not learn its interval")
+	}
+	if interval < 0 || grace < 0 {
+		nt.lock.Unlock()
+		return errors.New("interval and grace cannot be negative")
+	}
+	nt.status.LearnedInterval = interval
+	nt.status.LearnedGrace = grace
+	nt.status.Intervals = nil
+	switch nt.status.State {
+	case StateWaiting, StateLate, StateRecovered:
+		if nt.status.State == StateLate {
+			nt.setState(StateWaiting)
+		}
+		// The next signal is expected after the last one, it may be late already.
+		// Declared program which never called is expected from now.
+		last := nt.status.LastSignal
+		if last.IsZero() {
+			last = time.Now()
+		}
+		nt.arm(last)
+	}
+	nt.lock.Unlock()
+
+	nt.nanny.changed(nt)
+	return nil
+}
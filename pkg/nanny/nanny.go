@@ -2,8 +2,11 @@ package nanny
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
+	"nanny/pkg/calendar"
+	"nanny/pkg/cron"
 	"nanny/pkg/notifier"
 
 	"github.com/cornelk/hashmap"
@@ -14,27 +17,142 @@ import (
 // There should be only one nanny per process.
 type Nanny struct {
 	Name string // Nanny's name.
+	// Optional holiday calendars signals may refer to by their names, see
+	// Signal.Holidays.
+	Calendars map[string]*calendar.Calendar
 	// Function that will be called when notifier.Notify returns error.
 	// If not specified, uses defaultErrorFunc.
 	ErrorFunc ErrorFunc
-	timers    hashmap.HashMap // Map of program names (Signal.Name) to their timers.
+	// Optional function that will be called whenever a timer changes its state,
+	// may be used to persist timers.
+	ChangeFunc func(*Timer)
+	// Optional function that will be called whenever a group changes its state.
+	QuorumChangeFunc func(*Quorum)
+	timers           hashmap.HashMap // Map of program names (Signal.Name) to their timers.
+	silences         hashmap.HashMap // Map of silence IDs to silences.
+	held             hashmap.HashMap // Map of program names to alerting dependencies holding back their alerts.
+	groups           hashmap.HashMap // Map of group names to their quorums.
+
+	// Map of program names to their dependencies, see registerDependencies.
+	deps     map[string][]string
+	depsLock sync.Mutex
 }
 
 // Signal represents program calling nanny to notify with given notifier if
-// this program does not call again within NextSignal + MaxDeviation.
+// this program does not call again within NextSignal + Grace.
 type Signal struct {
 	// Name of program being monitored.
 	// Should be unique for each instance of a program.
-	Name       string
-	Notifier   notifier.Notifier // What notifier to use.
-	NextSignal time.Duration     // Notify after reaching this timeout.
-	AllClear   bool              // Activate optional all-clear notification
+	Name     string
+	Notifier notifier.Notifier // What notifier to use.
+	// Optional additional notifiers, each of them is notified independently.
+	Notifiers  []notifier.Notifier
+	NextSignal time.Duration    // Notify after reaching this timeout.
+	Grace      time.Duration    // Optional extra time to wait after NextSignal before notifying.
+	AllClear   bool             // Activate optional all-clear notification
+	Repeat     time.Duration    // Optional interval to repeat notification until the program signals again.
+	Escalation []EscalationStep // Optional escalation steps following the first notification.
 	Meta       map[string]string
+	Identity   string // Optional identity of the caller, e.g. its address, usually part of Name.
+
+	// Optional time of the next signal, e.g. sent by program which knows when it
+	// runs next. The next signal is expected at it while it is in the future, also
+	// when the signal is reset without a call, e.g. finished run.
+	Deadline time.Time
+
+	// Whether the signal is declared in config, see Expect. Calls of the program
+	// keep it declared.
+	Declared bool
+
+	// Optional schedule of the program, e.g. nightly job. When set, the next signal
+	// is expected at the next scheduled time plus Tolerance, instead of NextSignal
+	// after the last signal.
+	Schedule  *cron.Schedule
+	Location  *time.Location // Time zone of Schedule and Rules, UTC when nil.
+	Tolerance time.Duration  // How long after the scheduled time the program may signal.
+
+	// Optional interval rules, e.g. shorter interval during business hours. The
+	// next signal is expected after interval of the first rule matching time of
+	// the last signal in Location, NextSignal is used when no rule matches. Days
+	// of the optional holiday calendar are matched only by rules for holidays.
+	Rules    []IntervalRule
+	Holidays *calendar.Calendar
+
+	// Optional default maximum runtime of program's runs, see Timer.Start.
+	MaxRuntime time.Duration
+
+	// Optional names of signals this program depends on, e.g. message broker of
+	// a consumer. Alerts are held back while any of them is alerting, they are
+	// mentioned in its notifications instead.
+	DependsOn []string
+
+	// Optional flap detection: the timer is flapping when it changed between
+	// alerting and recovered FlapThreshold times within FlapWindow. One notification
+	// is sent then and alerts are suppressed until there is no change for FlapWindow.
+	FlapWindow    time.Duration
+	FlapThreshold int
+
+	// Optional hysteresis of all-clear notification, it is sent only after the
+	// program signalled StablePings times or for StableFor after recovery.
+	StablePings int
+	StableFor   time.Duration
+
+	// Optional detection of program signalling too often, e.g. in crash-restart
+	// loop. User is notified when the program signals sooner than MinInterval
+	// after the previous signal, or more than MaxRate times within RateWindow.
+	MinInterval time.Duration
+	MaxRate     int
+	RateWindow  time.Duration
+
+	// Optional inverse mode, e.g. for code paths that should never run. Any signal
+	// notifies right away, further signals within Cooldown do not notify again.
+	// The program is fine again when it does not signal for Cooldown. NextSignal
+	// is not used.
+	Inverse  bool
+	Cooldown time.Duration
+
+	// Optional throughput floor, e.g. for stream processors. The program must
+	// report at least MinThroughput events within ThroughputWindow, each signal
+	// reports Count events. NextSignal is not used.
+	MinThroughput    int
+	ThroughputWindow time.Duration
+	Count            int
+
+	// Optional numeric values reported by the program, e.g. number of processed
+	// records, checked by Assertions when there are any. Signal failing any of
+	// them notifies right away, like a failure of the program.
+	Values     map[string]float64
+	Assertions []Assertion
+
+	// Optional stall detection, e.g. for long-running jobs signalling from
+	// a background goroutine. The program is stalled when Progress, a counter or
+	// percentage reported by its signals, does not move within StallAfter.
+	StallAfter time.Duration
+	Progress   *float64
+
+	// Optional anomaly detection of runs, see Timer.Start. User is notified when
+	// a run takes longer than RuntimeFactor times the 95th percentile of runtimes
+	// of previous runs, once there are enough of them.
+	RuntimeFactor float64
+
+	// Optional learning of the interval, when NextSignal is not set. Interval
+	// between signals and its tolerance, used when Grace is not set, are derived
+	// from the first LearnPings signals, the timer does not expect any signal
+	// until then. See Timer.SetInterval to override them.
+	LearnPings int
 
 	// Optional callback function that will be called when notifier is called.
 	CallbackFunc func(*Signal)
 }
 
+// EscalationStep represents one step of escalation policy. Steps are followed
+// one by one until the program signals again.
+type EscalationStep struct {
+	After    time.Duration     // When to start this step, counted from the first notification.
+	Notifier notifier.Notifier // What notifier to use.
+	Repeat   time.Duration     // Optional interval to repeat notification until the next step.
+}
+
 // validSignal represents signal that is actually valid. It is created by calling
 // nanny.validate(Signal) internally.
 type validSignal Signal
@@ -49,14 +167,56 @@ func defaultErrorFunc(err error) {
 	fmt.Println(err)
 }
 
+// changed calls ChangeFunc if set and checks groups the timer may belong to.
+func (n *Nanny) changed(timer *Timer) {
+	if n.ChangeFunc != nil {
+		n.ChangeFunc(timer)
+	}
+	n.checkQuorums()
+}
+
+// deliver calls send for each notifier concurrently, so that one slow or failing
+// notifier does not block the others. Errors are passed to ErrorFunc for each
+// notifier separately, subject tells what the notification is about.
+func (n *Nanny) deliver(subject string, notifiers []notifier.Notifier, send func(notifier.Notifier) error) {
+	var wg sync.WaitGroup
+	for _, notif := range notifiers {
+		wg.Add(1)
+		go func(notif notifier.Notifier) {
+			defer wg.Done()
+			err := send(notif)
+			if err != nil {
+				// Add context to the error message and call ErrorFunc.
+				err = errors.Wrapf(err, "error calling notifier: %T with %s", notif, subject)
+				n.handleError(err)
+			}
+		}(notif)
+	}
+	wg.Wait()
+}
+
+// handleError passes err to ErrorFunc, or defaultErrorFunc if not specified.
+func (n *Nanny) handleError(err error) {
+	if n.ErrorFunc == nil {
+		defaultErrorFunc(err)
+	} else {
+		n.ErrorFunc(err)
+	}
+}
+
 // Handle creates new timer within `Nanny`, which calls `signal.Notifier.Notify()` if there is no
-// signal within NextSignal + MaxDeviation.
+// signal within NextSignal + Grace.
 func (n *Nanny) Handle(s Signal) error {
 	vs, err := n.validate(s)
 	if err != nil {
 		return errors.Wrap(err, "signal is invalid")
 	}
 
+	err = n.registerDependencies(vs)
+	if err != nil {
+		return errors.Wrap(err, "signal is invalid")
+	}
+
 	return n.handle(vs)
 }
 
@@ -68,13 +228,159 @@ func (n *Nanny) validate(s Signal) (validSignal, error) {
 		return vs, errors.New("signal.Handler is nil")
 	}
 
-	if s.NextSignal == 0 {
+	for i, notif := range s.Notifiers {
+		if notif == nil {
+			return vs, errors.Errorf("signal.Notifiers[%d] is nil", i)
+		}
+	}
+
+	if s.Inverse && s.Cooldown <= 0 {
+		return vs, errors.New("signal.Cooldown must be positive for inverse signal")
+	}
+
+	if s.Inverse && s.Schedule != nil {
+		return vs, errors.New("signal.Schedule cannot be used with inverse signal")
+	}
+
+	if s.MinThroughput < 0 || s.Count < 0 {
+		return vs, errors.New("signal.MinThroughput and signal.Count cannot be negative")
+	}
+
+	if (s.MinThroughput > 0) != (s.ThroughputWindow > 0) {
+		return vs, errors.New("signal.MinThroughput and signal.ThroughputWindow must be set together")
+	}
+
+	if s.MinThroughput > 0 && (s.Inverse || s.Schedule != nil) {
+		return vs, errors.New("signal.MinThroughput cannot be used with inverse or scheduled signal")
+	}
+
+	if s.LearnPings != 0 && s.LearnPings < 3 {
+		return vs, errors.New("signal.LearnPings must be at least 3")
+	}
+
+	if s.LearnPings > 0 && (s.Inverse || s.Schedule != nil || s.MinThroughput > 0) {
+		return vs, errors.New("signal.LearnPings cannot be used with inverse, scheduled or throughput signal")
+	}
+
+	if len(s.Rules) > 0 && (s.Inverse || s.Schedule != nil || s.MinThroughput > 0 || s.LearnPings > 0) {
+		return vs, errors.New("signal.Rules cannot be used with inverse, scheduled, throughput or learning signal")
+	}
+
+	if s.Holidays != nil && len(s.Rules) == 0 {
+		return vs, errors.New("signal.Holidays cannot be used without signal.Rules")
+	}
+
+	for i, r := range s.Rules {
+		if err := r.validate(); err != nil {
+			return vs, errors.Wrapf(err, "signal.Rules[%d] is invalid", i)
+		}
+	}
+
+	if !s.Inverse && s.MinThroughput == 0 && s.Schedule == nil && s.LearnPings == 0 && s.NextSignal == 0 {
 		return vs, errors.New("signal.NextSignal cannot be 0")
 	}
 
+	if s.Schedule != nil && s.Schedule.Next(time.Now()).IsZero() {
+		return vs, errors.Errorf("signal.Schedule %s never happens", s.Schedule)
+	}
+
+	if s.Tolerance < 0 {
+		return vs, errors.New("signal.Tolerance cannot be negative")
+	}
+
+	if s.MaxRuntime < 0 {
+		return vs, errors.New("signal.MaxRuntime cannot be negative")
+	}
+
+	if s.FlapThreshold < 0 || s.FlapThreshold == 1 {
+		return vs, errors.New("signal.FlapThreshold must be at least 2")
+	}
+
+	if (s.FlapThreshold > 0) != (s.FlapWindow > 0) {
+		return vs, errors.New("signal.FlapWindow and signal.FlapThreshold must be set together")
+	}
+
+	if s.MinInterval < 0 {
+		return vs, errors.New("signal.MinInterval cannot be negative")
+	}
+
+	if s.MaxRate < 0 {
+		return vs, errors.New("signal.MaxRate cannot be negative")
+	}
+
+	if (s.MaxRate > 0) != (s.RateWindow > 0) {
+		return vs, errors.New("signal.MaxRate and signal.RateWindow must be set together")
+	}
+
+	if s.StablePings < 0 || s.StableFor < 0 {
+		return vs, errors.New("signal.StablePings and signal.StableFor cannot be negative")
+	}
+
+	if s.RuntimeFactor != 0 && s.RuntimeFactor < 1 {
+		return vs, errors.New("signal.RuntimeFactor must be at least 1")
+	}
+
+	if s.StallAfter < 0 {
+		return vs, errors.New("signal.StallAfter cannot be negative")
+	}
+
+	if s.StallAfter > 0 && s.Inverse {
+		return vs, errors.New("signal.StallAfter cannot be used with inverse signal")
+	}
+
+	for i, a := range s.Assertions {
+		if err := a.validate(); err != nil {
+			return vs, errors.Wrapf(err, "signal.Assertions[%d] is invalid", i)
+		}
+	}
+
+	for _, name := range s.DependsOn {
+		if name == s.Name {
+			return vs, errors.New("signal.DependsOn cannot contain the signal itself")
+		}
+	}
+
+	if s.Grace < 0 {
+		return vs, errors.New("signal.Grace cannot be negative")
+	}
+
+	if s.Repeat < 0 {
+		return vs, errors.New("signal.Repeat cannot be negative")
+	}
+
+	var after time.Duration
+	for i, step := range s.Escalation {
+		if step.Notifier == nil {
+			return vs, errors.Errorf("signal.Escalation[%d].Notifier is nil", i)
+		}
+		if step.After <= after {
+			return vs, errors.Errorf("signal.Escalation[%d].After must be greater than previous step", i)
+		}
+		if step.Repeat < 0 {
+			return vs, errors.Errorf("signal.Escalation[%d].Repeat cannot be negative", i)
+		}
+		after = step.After
+	}
+
 	return validSignal(s), nil
 }
 
+// deadline returns when the next signal is expected, without grace period, if the
+// program signalled at given time.
+func (s validSignal) deadline(signalled time.Time) time.Time {
+	if s.Deadline.After(signalled) {
+		return s.Deadline
+	}
+	if s.Schedule == nil {
+		return signalled.Add(s.intervalAt(signalled))
+	}
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return s.Schedule.Next(signalled.In(loc)).Add(s.Tolerance)
+}
+
 // handle is called only when signal has been successfully validated.
 func (n *Nanny) handle(s validSignal) error {
 	// Check if this program already has goroutine that needs cancelling.
@@ -82,20 +388,110 @@ func (n *Nanny) handle(s validSignal) error {
 
 	if timer != nil {
 		// Timer exists, reset the timer to the new signal value.
-		// Send all-clear notification if requested
-		if s.AllClear && time.Now().After(timer.end) {
-			timer.ResetAllClear(s)
-		} else {
-			timer.Reset(s)
-		}
+		// All-clear notification is sent if the program was alerting.
+		timer.Reset(s)
 	} else {
 		// No timer is registered for this program, create it.
-		n.SetTimer(s.Name, newTimer(s, n))
+		timer := newTimer(s, n)
+		n.SetTimer(s.Name, timer)
+		n.checkQuorums()
+		if failed := s.failedAssertion(s.Values); failed != "" && !s.Inverse {
+			timer.lock.Lock()
+			timer.failAssertion(time.Now(), failed)
+		}
 	}
 
 	return nil
 }
 
+// Restore creates timer for given signal in previously persisted state, see
+// Timer.Status. It is used to load timers after restart.
+func (n *Nanny) Restore(s Signal, status Status) error {
+	vs, err := n.validate(s)
+	if err != nil {
+		return errors.Wrap(err, "signal is invalid")
+	}
+
+	err = n.registerDependencies(vs)
+	if err != nil {
+		return errors.Wrap(err, "signal is invalid")
+	}
+
+	timer := restoreTimer(vs, status, n)
+	timer.lock.Lock()
+	timer.resume()
+	timer.lock.Unlock()
+	n.SetTimer(s.Name, timer)
+	return nil
+}
+
+// Expect creates timer for program which has not signalled yet, e.g. declared in
+// config, the first signal is expected within first. Zero first means the usual
+// deadline of the signal. Timer of already registered program keeps its state,
+// only its settings are updated and its deadline is moved when they change it.
+func (n *Nanny) Expect(s Signal, first time.Duration) error {
+	vs, err := n.validate(s)
+	if err != nil {
+		return errors.Wrap(err, "signal is invalid")
+	}
+
+	err = n.registerDependencies(vs)
+	if err != nil {
+		return errors.Wrap(err, "signal is invalid")
+	}
+
+	timer := n.GetTimer(s.Name)
+	if timer != nil {
+		timer.lock.Lock()
+		rescheduled := timer.reschedule(vs, first)
+		timer.lock.Unlock()
+		if rescheduled {
+			n.changed(timer)
+		}
+		return nil
+	}
+
+	timer = newTimer(vs, n)
+	timer.lock.Lock()
+	// Registration is not a call of the program.
+	timer.expected = time.Now()
+	timer.status.LastSignal = time.Time{}
+	timer.status.Arrivals = nil
+	if first > 0 && !vs.Inverse && !timer.learning() {
+		timer.status.NextSignal = time.Now().Add(first)
+		timer.wake(timer.status.NextSignal)
+	}
+	timer.lock.Unlock()
+	n.SetTimer(s.Name, timer)
+	n.checkQuorums()
+	return nil
+}
+
+// Pause pauses timer of given program, it will not notify until resumed.
+// Returns false if no such program is registered.
+func (n *Nanny) Pause(name string) bool {
+	timer := n.GetTimer(name)
+	if timer == nil {
+		return false
+	}
+	timer.Pause()
+	n.held.Del(name)
+	// Dependent signals may alert now.
+	n.recheckSuppressed()
+	return true
+}
+
+// Resume resumes paused timer of given program. Returns false if no such program
+// is registered.
+func (n *Nanny) Resume(name string) bool {
+	timer := n.GetTimer(name)
+	if timer == nil {
+		return false
+	}
+	timer.Resume()
+	return true
+}
+
 // GetTimer returns time.Timer when given program name is already registered or
 // nil.
 func (n *Nanny) GetTimer(name string) *Timer {
@@ -111,13 +507,29 @@ func (n *Nanny) SetTimer(name string, timer *Timer) {
 	n.timers.Set(name, timer)
 }
 
+// Remove stops the timer of given program and removes it from nanny. Returns
+// false if no such program is registered.
+func (n *Nanny) Remove(name string) bool {
+	timer := n.GetTimer(name)
+	if timer == nil {
+		return false
+	}
+	timer.Stop()
+	n.timers.Del(name)
+	n.held.Del(name)
+	n.unregisterDependencies(name)
+	// Dependent signals may alert now.
+	n.recheckSuppressed()
+	n.checkQuorums()
+	return true
+}
+
 // GetTimers returns a slice of currently open timers
 func (n *Nanny) GetTimers() []*Timer {
-	timers := make([]*Timer, n.timers.Len())
-	index := 0
+	// Timers may be added while iterating, the length is only a hint.
+	timers := make([]*Timer, 0, n.timers.Len())
 	for timer := range n.timers.Iter() {
-		timers[index] = timer.Value.(*Timer)
-		index = index + 1
+		timers = append(timers, timer.Value.(*Timer))
 	}
 	return timers
 }
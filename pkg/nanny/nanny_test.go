@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"nanny/pkg/calendar"
+	"nanny/pkg/cron"
 	"nanny/pkg/nanny"
 	"nanny/pkg/notifier"
 )
@@ -64,6 +67,24 @@ func (d *DummyNotifierWithError) String() string {
 	return "dummy with error"
 }
 
+// BlockingNotifier is DummyNotifier which waits until release is closed.
+type BlockingNotifier struct {
+	DummyNotifier
+	release chan struct{}
+}
+
+// Notify waits for release and stores `msg` in the BlockingNotifier.
+func (b *BlockingNotifier) Notify(msg notifier.Message) error {
+	<-b.release
+	return b.DummyNotifier.Notify(msg)
+}
+
+// NotifyAllClear waits for release and stores `msg` in the BlockingNotifier.
+func (b *BlockingNotifier) NotifyAllClear(msg notifier.Message) error {
+	<-b.release
+	return b.DummyNotifier.NotifyAllClear(msg)
+}
+
 func createTimer(nannyName, signalName string, duration time.Duration, meta map[string]string) *nanny.Timer {
 	n := nanny.Nanny{Name: nannyName}
 	dummy := &DummyNotifier{}
@@ -626,3 +647,1828 @@ func TestTimerMarshalJSONNextSignal(t *testing.T) {
 		t.Errorf("Expected next_signal in json to be less than 1s, got: %v\n", diff)
 	}
 }
+
+// TestNannyGrace tests that notifier is called only after NextSignal + Grace and
+// that the timer reports being late in between.
+func TestNannyGrace(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny grace"}
+	dummy := &DummyNotifier{}
+	err := n.Handle(nanny.Signal{
+		Name:       "test grace",
+		Notifier:   dummy,
+		NextSignal: time.Duration(500) * time.Millisecond,
+		Grace:      time.Duration(500) * time.Millisecond,
+	})
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	timer := n.GetTimer("test grace")
+	if timer.Late() {
+		t.Errorf("timer should not be late before NextSignal time expires")
+	}
+
+	// After NextSignal, we should be late but not notified yet.
+	time.Sleep(time.Duration(700) * time.Millisecond)
+	dummyMsg := dummy.NotifyMsg()
+	if dummyMsg.Program != "" {
+		t.Errorf("dummy msg should be empty before grace period expires: %v\n", dummyMsg)
+	}
+	if !timer.Late() {
+		t.Errorf("timer should be late after NextSignal time expired")
+	}
+
+	// After NextSignal + Grace, DummyNotifier should have the message.
+	time.Sleep(time.Duration(400) * time.Millisecond)
+	dummyMsg = dummy.NotifyMsg()
+	if dummyMsg.Program == "" {
+		t.Errorf("dummy msg should not be empty after grace period expired: %v\n", dummyMsg)
+	}
+	if timer.Late() {
+		t.Errorf("timer should not be late after grace period expired")
+	}
+}
+
+func TestNegativeGrace(t *testing.T) {
+	n := nanny.Nanny{}
+	signal := nanny.Signal{
+		Notifier:   &DummyNotifier{},
+		NextSignal: time.Second,
+		Grace:      -time.Second,
+	}
+
+	err := n.Handle(signal)
+	if err == nil {
+		t.Errorf("nanny.Handle should return error when signal.Grace is negative\n")
+	}
+}
+
+// TestNannyEscalation tests that notification is repeated and escalated to the
+// next notifier until the program signals again.
+func TestNannyEscalation(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny escalation"}
+	first := &DummyNotifier{}
+	second := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:       "test escalation",
+		Notifier:   first,
+		NextSignal: time.Duration(200) * time.Millisecond,
+		Repeat:     time.Duration(200) * time.Millisecond,
+		Escalation: []nanny.EscalationStep{
+			{After: time.Duration(500) * time.Millisecond, Notifier: second},
+		},
+	}
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+
+	// First notification at 200ms, reminders at 400ms and 600ms, escalation at 700ms.
+	time.Sleep(time.Duration(300) * time.Millisecond)
+	dummyMsg := first.NotifyMsg()
+	if dummyMsg.Program == "" || dummyMsg.Reminder != 0 {
+		t.Errorf("first notifier should be notified without reminder: %+v\n", dummyMsg)
+	}
+	time.Sleep(time.Duration(200) * time.Millisecond)
+	dummyMsg = first.NotifyMsg()
+	if dummyMsg.Reminder != 1 {
+		t.Errorf("first notifier should be reminded once: %+v\n", dummyMsg)
+	}
+	if second.NotifyMsg().Program != "" {
+		t.Errorf("second notifier should not be notified before escalation: %+v\n", second.NotifyMsg())
+	}
+	time.Sleep(time.Duration(300) * time.Millisecond)
+	dummyMsg = second.NotifyMsg()
+	if dummyMsg.Step != 1 || dummyMsg.Reminder != 3 {
+		t.Errorf("second notifier should be notified as escalation step 1: %+v\n", dummyMsg)
+	}
+
+	// Signal stops the escalation.
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(150) * time.Millisecond)
+	dummyMsg = second.NotifyMsg()
+	if dummyMsg.Reminder != 3 {
+		t.Errorf("second notifier should not be notified after signal: %+v\n", dummyMsg)
+	}
+}
+
+func TestInvalidEscalation(t *testing.T) {
+	n := nanny.Nanny{}
+	signal := nanny.Signal{
+		Notifier:   &DummyNotifier{},
+		NextSignal: time.Second,
+		Escalation: []nanny.EscalationStep{
+			{After: time.Minute, Notifier: &DummyNotifier{}},
+			{After: time.Second, Notifier: &DummyNotifier{}},
+		},
+	}
+
+	err := n.Handle(signal)
+	if err == nil {
+		t.Errorf("nanny.Handle should return error when escalation steps are not ordered\n")
+	}
+}
+
+// TestNannyMultipleNotifiers tests that all notifiers are notified, even when one
+// of them returns error.
+func TestNannyMultipleNotifiers(t *testing.T) {
+	var (
+		errCount int
+		lock     sync.Mutex
+	)
+	errFunc := func(err error) {
+		lock.Lock()
+		errCount++
+		lock.Unlock()
+	}
+	n := nanny.Nanny{Name: "test nanny multiple notifiers", ErrorFunc: errFunc}
+	dummy := &DummyNotifier{}
+	err := n.Handle(nanny.Signal{
+		Name:       "test multiple notifiers",
+		Notifier:   &DummyNotifierWithError{},
+		Notifiers:  []notifier.Notifier{dummy},
+		NextSignal: time.Duration(200) * time.Millisecond,
+	})
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+
+	time.Sleep(time.Duration(300) * time.Millisecond)
+	dummyMsg := dummy.NotifyMsg()
+	if dummyMsg.Program == "" {
+		t.Errorf("dummy msg should not be empty after NextSignal time expired: %v\n", dummyMsg)
+	}
+	lock.Lock()
+	if errCount != 1 {
+		t.Errorf("ErrorFunc should be called once for failing notifier, got: %d\n", errCount)
+	}
+	lock.Unlock()
+}
+
+func TestNannyRemove(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny remove"}
+	dummy := &DummyNotifier{}
+	err := n.Handle(nanny.Signal{
+		Name:       "test remove",
+		Notifier:   dummy,
+		NextSignal: time.Duration(200) * time.Millisecond,
+	})
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+
+	if !n.Remove("test remove") {
+		t.Errorf("n.Remove should return true for registered signal")
+	}
+	if n.Remove("test remove") {
+		t.Errorf("n.Remove should return false for removed signal")
+	}
+	if n.GetTimer("test remove") != nil {
+		t.Errorf("n.GetTimer should return nil for removed signal")
+	}
+
+	time.Sleep(time.Duration(300) * time.Millisecond)
+	dummyMsg := dummy.NotifyMsg()
+	if dummyMsg.Program != "" {
+		t.Errorf("dummy msg should be empty for removed signal: %v\n", dummyMsg)
+	}
+}
+
+// TestTimerStates tests the timer's lifecycle transitions.
+func TestTimerStates(t *testing.T) {
+	var (
+		changes []nanny.State
+		lock    sync.Mutex
+	)
+	n := nanny.Nanny{Name: "test nanny states", ChangeFunc: func(timer *nanny.Timer) {
+		lock.Lock()
+		changes = append(changes, timer.State())
+		lock.Unlock()
+	}}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:       "test states",
+		Notifier:   dummy,
+		NextSignal: time.Duration(200) * time.Millisecond,
+		Grace:      time.Duration(200) * time.Millisecond,
+	}
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	timer := n.GetTimer("test states")
+	if timer.State() != nanny.StateWaiting {
+		t.Errorf("timer should be waiting, got: %s\n", timer.State())
+	}
+	time.Sleep(time.Duration(300) * time.Millisecond)
+	if timer.State() != nanny.StateLate {
+		t.Errorf("timer should be late, got: %s\n", timer.State())
+	}
+	time.Sleep(time.Duration(200) * time.Millisecond)
+	if timer.State() != nanny.StateAlerting {
+		t.Errorf("timer should be alerting, got: %s\n", timer.State())
+	}
+	if timer.Status().AlertedAt.IsZero() {
+		t.Errorf("timer should have AlertedAt set")
+	}
+
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if timer.State() != nanny.StateRecovered {
+		t.Errorf("timer should be recovered, got: %s\n", timer.State())
+	}
+	if timer.Status().RecoveredAt.IsZero() {
+		t.Errorf("timer should have RecoveredAt set")
+	}
+
+	n.Pause("test states")
+	if timer.State() != nanny.StatePaused {
+		t.Errorf("timer should be paused, got: %s\n", timer.State())
+	}
+	time.Sleep(time.Duration(500) * time.Millisecond)
+	if timer.State() != nanny.StatePaused {
+		t.Errorf("paused timer should stay paused, got: %s\n", timer.State())
+	}
+	n.Resume("test states")
+	if timer.State() != nanny.StateWaiting {
+		t.Errorf("timer should be waiting after resume, got: %s\n", timer.State())
+	}
+
+	expected := []nanny.State{
+		nanny.StateLate, nanny.StateAlerting, nanny.StateRecovered,
+		nanny.StatePaused, nanny.StateWaiting,
+	}
+	lock.Lock()
+	if fmt.Sprint(changes) != fmt.Sprint(expected) {
+		t.Errorf("ChangeFunc should be called for each state change, expected: %v, got: %v\n", expected, changes)
+	}
+	lock.Unlock()
+}
+
+// TestNannyRestore tests that restored alerting timer does not notify again, but
+// sends all-clear when the program signals.
+func TestNannyRestore(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny restore"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:       "test restore",
+		Notifier:   dummy,
+		NextSignal: time.Duration(200) * time.Millisecond,
+		AllClear:   true,
+	}
+	err := n.Restore(signal, nanny.Status{
+		State:      nanny.StateAlerting,
+		NextSignal: time.Now().Add(-time.Hour),
+		AlertedAt:  time.Now().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Errorf("n.Restore should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(100) * time.Millisecond)
+	if dummy.NotifyMsg().Program != "" {
+		t.Errorf("restored alerting timer should not notify again: %v\n", dummy.NotifyMsg())
+	}
+
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if dummy.NotifyMsg().Program == "" {
+		t.Errorf("restored alerting timer should send all-clear")
+	}
+	if n.GetTimer("test restore").State() != nanny.StateRecovered {
+		t.Errorf("timer should be recovered, got: %s\n", n.GetTimer("test restore").State())
+	}
+}
+
+func TestNannyAck(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny ack"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:       "test ack",
+		Notifier:   dummy,
+		NextSignal: time.Duration(100) * time.Millisecond,
+		Repeat:     time.Duration(100) * time.Millisecond,
+		AllClear:   true,
+	}
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	timer := n.GetTimer("test ack")
+	err = timer.Acknowledge(nanny.Ack{By: "admin"})
+	if err == nil {
+		t.Errorf("acknowledging waiting timer should return error")
+	}
+
+	time.Sleep(time.Duration(150) * time.Millisecond)
+	err = timer.Acknowledge(nanny.Ack{By: "admin", Note: "on it", Until: time.Now().Add(time.Duration(300) * time.Millisecond)})
+	if err != nil {
+		t.Errorf("acknowledging alerting timer should not return error, got: %v\n", err)
+	}
+	if timer.Status().Ack.By != "admin" || timer.Status().Ack.At.IsZero() {
+		t.Errorf("timer should be acknowledged by admin, got: %+v\n", timer.Status().Ack)
+	}
+
+	// No reminders while acknowledged.
+	time.Sleep(time.Duration(250) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Reminder != 0 {
+		t.Errorf("acknowledged timer should not send reminders, got reminder: %d\n", msg.Reminder)
+	}
+
+	// Reminders continue after the acknowledgement expires.
+	time.Sleep(time.Duration(100) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Reminder != 1 {
+		t.Errorf("expired acknowledgement should resume reminders, got reminder: %d\n", msg.Reminder)
+	}
+	if !timer.Status().Ack.At.IsZero() {
+		t.Errorf("expired acknowledgement should be cleared, got: %+v\n", timer.Status().Ack)
+	}
+
+	// Acknowledged timer recovers as usual and the acknowledgement is cleared.
+	err = timer.Acknowledge(nanny.Ack{By: "admin"})
+	if err != nil {
+		t.Errorf("acknowledging alerting timer should not return error, got: %v\n", err)
+	}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if timer.State() != nanny.StateRecovered {
+		t.Errorf("acknowledged timer should recover, got: %s\n", timer.State())
+	}
+	if !timer.Status().Ack.At.IsZero() {
+		t.Errorf("acknowledgement should be cleared on recovery, got: %+v\n", timer.Status().Ack)
+	}
+}
+
+func TestNannySilence(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny silence"}
+	dummy := &DummyNotifier{}
+	_, err := n.AddSilence(nanny.Silence{
+		Matchers: []nanny.Matcher{{Value: "test silence*"}, {Meta: "env", Value: "prod|stage", Regex: true}},
+		Start:    time.Now(),
+		End:      time.Now().Add(time.Duration(300) * time.Millisecond),
+	})
+	if err != nil {
+		t.Errorf("n.AddSilence should not return error, got: %v\n", err)
+	}
+	signal := nanny.Signal{
+		Name:       "test silence",
+		Notifier:   dummy,
+		NextSignal: time.Duration(100) * time.Millisecond,
+		Meta:       map[string]string{"env": "prod"},
+	}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	timer := n.GetTimer("test silence")
+
+	time.Sleep(time.Duration(150) * time.Millisecond)
+	if timer.State() != nanny.StateAlerting {
+		t.Errorf("silenced timer should be alerting, got: %s\n", timer.State())
+	}
+	if msg := dummy.NotifyMsg(); msg.Program != "" {
+		t.Errorf("silenced timer should not notify, got: %v\n", msg)
+	}
+
+	// Suppressed notification is sent when the silence ends.
+	time.Sleep(time.Duration(200) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Program != "test silence" {
+		t.Errorf("timer should notify after silence ends, got: %v\n", msg)
+	}
+}
+
+func TestSilenceRecurring(t *testing.T) {
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	n := nanny.Nanny{}
+	s, err := n.AddSilence(nanny.Silence{
+		Matchers: []nanny.Matcher{{Meta: "env", Value: "prod"}},
+		Start:    time.Date(2020, 1, 1, 0, 0, 0, 0, prague),
+		Cron:     "0 2 * * sat",
+		Duration: time.Duration(2) * time.Hour,
+		Location: prague,
+	})
+	if err != nil {
+		t.Errorf("n.AddSilence should not return error, got: %v\n", err)
+	}
+	if s.ID == "" {
+		t.Errorf("n.AddSilence should generate ID")
+	}
+
+	for _, test := range []struct {
+		now      time.Time
+		expected time.Time
+	}{
+		{time.Date(2020, 1, 4, 1, 59, 0, 0, prague), time.Time{}},
+		{time.Date(2020, 1, 4, 2, 0, 0, 0, prague), time.Date(2020, 1, 4, 4, 0, 0, 0, prague)},
+		{time.Date(2020, 1, 4, 3, 59, 0, 0, prague), time.Date(2020, 1, 4, 4, 0, 0, 0, prague)},
+		{time.Date(2020, 1, 4, 4, 0, 0, 0, prague), time.Time{}},
+		{time.Date(2020, 1, 5, 3, 0, 0, 0, prague), time.Time{}},
+	} {
+		if got := s.ActiveUntil(test.now); !got.Equal(test.expected) {
+			t.Errorf("silence at %s should be active until %s, got: %s\n", test.now, test.expected, got)
+		}
+	}
+
+	if s.Matches(nanny.Signal{Name: "test", Meta: map[string]string{"env": "stage"}}) {
+		t.Errorf("silence should not match signal with different meta")
+	}
+
+	for _, invalid := range []nanny.Silence{
+		{End: time.Now().Add(time.Hour)},
+		{Matchers: []nanny.Matcher{{Value: "test"}}},
+		{Matchers: []nanny.Matcher{{Value: "(", Regex: true}}, End: time.Now().Add(time.Hour)},
+		{Matchers: []nanny.Matcher{{Value: "test"}}, Cron: "0 2 * * sat"},
+		{Matchers: []nanny.Matcher{{Value: "test"}}, Cron: "invalid", Duration: time.Hour},
+	} {
+		_, err = n.AddSilence(invalid)
+		if err == nil {
+			t.Errorf("n.AddSilence should return error for invalid silence: %+v\n", invalid)
+		}
+	}
+}
+
+func TestNannySchedule(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny schedule"}
+	schedule, err := cron.Parse("30 2 * * *")
+	if err != nil {
+		t.Fatalf("cron.Parse should not return error, got: %v\n", err)
+	}
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	signal := nanny.Signal{
+		Name:      "test schedule",
+		Notifier:  &DummyNotifier{},
+		Schedule:  schedule,
+		Location:  prague,
+		Tolerance: time.Duration(1) * time.Hour,
+	}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+
+	next := n.GetTimer("test schedule").Status().NextSignal.In(prague)
+	if next.Hour() != 3 || next.Minute() != 30 || !next.After(time.Now()) || next.After(time.Now().Add(25*time.Hour)) {
+		t.Errorf("next signal should be expected at the next 03:30 in Prague, got: %s\n", next)
+	}
+
+	never, err := cron.Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("cron.Parse should not return error, got: %v\n", err)
+	}
+	signal.Schedule = never
+	err = n.Handle(signal)
+	if err == nil {
+		t.Errorf("n.Signal should return error for schedule which never happens")
+	}
+}
+
+func TestNannyRun(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny run"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:       "test run",
+		Notifier:   dummy,
+		NextSignal: time.Duration(1) * time.Hour,
+		MaxRuntime: time.Duration(100) * time.Millisecond,
+		AllClear:   true,
+	}
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	timer := n.GetTimer("test run")
+
+	_, err = timer.Finish()
+	if err == nil {
+		t.Errorf("finishing run which was not started should return error")
+	}
+
+	// Finished run does not notify.
+	err = timer.Start(0)
+	if err != nil {
+		t.Errorf("timer.Start should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(50) * time.Millisecond)
+	runtime, err := timer.Finish()
+	if err != nil {
+		t.Errorf("timer.Finish should not return error, got: %v\n", err)
+	}
+	if runtime < time.Duration(50)*time.Millisecond || timer.Status().LastRuntime != runtime {
+		t.Errorf("runtime should be recorded, got: %s, status: %s\n", runtime, timer.Status().LastRuntime)
+	}
+	time.Sleep(time.Duration(100) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Program != "" {
+		t.Errorf("finished run should not notify, got: %v\n", msg)
+	}
+
+	// Run which does not finish in time notifies.
+	err = timer.Start(time.Duration(200) * time.Millisecond)
+	if err != nil {
+		t.Errorf("timer.Start should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(250) * time.Millisecond)
+	if timer.State() != nanny.StateAlerting {
+		t.Errorf("timer should be alerting, got: %s\n", timer.State())
+	}
+	msg := dummy.NotifyMsg()
+	if msg.Kind != notifier.KindRuntime {
+		t.Errorf("message should be about runtime, got: %s\n", msg.Kind)
+	}
+	if !strings.Contains(msg.Format(), "did not finish in 200ms") {
+		t.Errorf("message should say the run did not finish, got: %s\n", msg.Format())
+	}
+
+	_, err = timer.Finish()
+	if err != nil {
+		t.Errorf("timer.Finish should not return error, got: %v\n", err)
+	}
+	if timer.State() != nanny.StateRecovered {
+		t.Errorf("finished timer should recover, got: %s\n", timer.State())
+	}
+}
+
+func TestNannyFail(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny fail"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:       "test fail",
+		Notifier:   dummy,
+		NextSignal: time.Duration(1) * time.Hour,
+		AllClear:   true,
+	}
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	timer := n.GetTimer("test fail")
+
+	err = timer.Fail(2, "no space left on device")
+	if err != nil {
+		t.Errorf("timer.Fail should not return error, got: %v\n", err)
+	}
+	if timer.State() != nanny.StateAlerting {
+		t.Errorf("failed timer should be alerting, got: %s\n", timer.State())
+	}
+	msg := dummy.NotifyMsg()
+	if msg.Kind != notifier.KindFailure || msg.ExitCode != 2 {
+		t.Errorf("failure should be notified immediately, got: %v\n", msg)
+	}
+	if !strings.Contains(msg.Format(), "failed with exit code 2!") || !strings.Contains(msg.Format(), "no space left on device") {
+		t.Errorf("message should contain exit code and log, got: %s\n", msg.Format())
+	}
+
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if timer.State() != nanny.StateRecovered {
+		t.Errorf("timer should recover after successful signal, got: %s\n", timer.State())
+	}
+
+	n.Pause("test fail")
+	err = timer.Fail(1, "")
+	if err == nil {
+		t.Errorf("timer.Fail should return error for paused timer")
+	}
+}
+
+func TestNannyDependencies(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny dependencies"}
+	brokerNotifier := &DummyNotifier{}
+	consumerNotifier := &DummyNotifier{}
+	broker := nanny.Signal{
+		Name:       "broker",
+		Notifier:   brokerNotifier,
+		NextSignal: time.Duration(1) * time.Hour,
+	}
+	consumer := nanny.Signal{
+		Name:       "consumer",
+		Notifier:   consumerNotifier,
+		NextSignal: time.Duration(1) * time.Hour,
+		DependsOn:  []string{"broker"},
+	}
+	for _, signal := range []nanny.Signal{broker, consumer} {
+		err := n.Handle(signal)
+		if err != nil {
+			t.Errorf("n.Signal should not return error, got: %v\n", err)
+		}
+	}
+
+	err := n.GetTimer("broker").Fail(1, "")
+	if err != nil {
+		t.Errorf("timer.Fail should not return error, got: %v\n", err)
+	}
+	timer := n.GetTimer("consumer")
+	err = timer.Fail(1, "")
+	if err != nil {
+		t.Errorf("timer.Fail should not return error, got: %v\n", err)
+	}
+	if timer.State() != nanny.StateAlerting {
+		t.Errorf("held timer should still be alerting, got: %s\n", timer.State())
+	}
+	if msg := consumerNotifier.NotifyMsg(); msg.Program != "" {
+		t.Errorf("dependent alert should be held back while broker is alerting, got: %v\n", msg)
+	}
+	b, _ := json.Marshal(timer)
+	if !strings.Contains(string(b), `"held_by":"broker"`) {
+		t.Errorf("held timer should show its dependency, got: %s\n", b)
+	}
+
+	// Next notification of the broker mentions the consumer.
+	err = n.GetTimer("broker").Fail(1, "")
+	if err != nil {
+		t.Errorf("timer.Fail should not return error, got: %v\n", err)
+	}
+	msg := brokerNotifier.NotifyMsg()
+	if len(msg.Dependents) != 1 || msg.Dependents[0] != "consumer" {
+		t.Errorf("broker's message should mention held consumer, got: %v\n", msg.Dependents)
+	}
+	if !strings.Contains(msg.Format(), `"consumer"`) {
+		t.Errorf("formatted message should mention held consumer, got: %s\n", msg.Format())
+	}
+
+	// When the broker recovers, the consumer notifies on its own.
+	err = n.Handle(broker)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(50) * time.Millisecond)
+	if msg := consumerNotifier.NotifyMsg(); msg.Program != "consumer" {
+		t.Errorf("consumer should notify after broker recovered, got: %v\n", msg)
+	}
+
+	// Cycles are rejected.
+	broker.DependsOn = []string{"consumer"}
+	err = n.Handle(broker)
+	if err == nil {
+		t.Errorf("n.Signal should return error for dependency cycle")
+	}
+	consumer.DependsOn = []string{"consumer"}
+	err = n.Handle(consumer)
+	if err == nil {
+		t.Errorf("n.Signal should return error for signal depending on itself")
+	}
+}
+
+// TestNannyConcurrentDependencies registers signals with dependencies from many
+// goroutines, run with -race.
+func TestNannyConcurrentDependencies(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny concurrent dependencies"}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(num int) {
+			defer wg.Done()
+			err := n.Handle(nanny.Signal{
+				Name:       fmt.Sprintf("consumer %d", num),
+				Notifier:   &DummyNotifier{},
+				NextSignal: time.Duration(1) * time.Hour,
+				DependsOn:  []string{fmt.Sprintf("consumer %d", num+1)},
+			})
+			if err != nil {
+				t.Errorf("n.Signal should not return error, got: %v\n", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if timers := n.GetTimers(); len(timers) != 50 {
+		t.Errorf("all signals should be registered, got: %d\n", len(timers))
+	}
+
+	// Concurrent signals can not create a cycle together.
+	for i := 0; i < 20; i++ {
+		var registered int32
+		for _, pair := range [][2]string{{"a", "b"}, {"b", "a"}} {
+			wg.Add(1)
+			go func(name, parent string) {
+				defer wg.Done()
+				err := n.Handle(nanny.Signal{
+					Name:       fmt.Sprintf("%s %d", name, i),
+					Notifier:   &DummyNotifier{},
+					NextSignal: time.Duration(1) * time.Hour,
+					DependsOn:  []string{fmt.Sprintf("%s %d", parent, i)},
+				})
+				if err == nil {
+					atomic.AddInt32(&registered, 1)
+				}
+			}(pair[0], pair[1])
+		}
+		wg.Wait()
+		if registered != 1 {
+			t.Errorf("exactly one of the signals depending on each other should be registered, got: %d\n", registered)
+		}
+	}
+}
+
+func TestNannyGroup(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny group"}
+	memberNotifier := &DummyNotifier{}
+	groupNotifier := &DummyNotifier{}
+	var members []nanny.Signal
+	for i := 1; i <= 5; i++ {
+		signal := nanny.Signal{
+			Name:       fmt.Sprintf("worker@10.0.0.%d", i),
+			Notifier:   memberNotifier,
+			NextSignal: time.Duration(1) * time.Hour,
+		}
+		err := n.Handle(signal)
+		if err != nil {
+			t.Errorf("n.Signal should not return error, got: %v\n", err)
+		}
+		members = append(members, signal)
+	}
+
+	err := n.AddGroup(nanny.Group{Name: "workers", MinAlive: 3, Notifier: groupNotifier})
+	if err == nil {
+		t.Errorf("n.AddGroup should return error for group without prefix and meta")
+	}
+	err = n.AddGroup(nanny.Group{
+		Name:     "workers",
+		Prefix:   "worker@",
+		MinAlive: 3,
+		Notifier: groupNotifier,
+		AllClear: true,
+	})
+	if err != nil {
+		t.Errorf("n.AddGroup should not return error, got: %v\n", err)
+	}
+	q := n.GetQuorum("workers")
+	if status := q.Status(); status.Alive != 5 || status.Members != 5 || status.State != nanny.StateWaiting {
+		t.Errorf("all members should be alive, got: %+v\n", status)
+	}
+
+	// Members stop calling.
+	for i := 0; i < 2; i++ {
+		silent := members[i]
+		silent.NextSignal = time.Duration(100) * time.Millisecond
+		err = n.Handle(silent)
+		if err != nil {
+			t.Errorf("n.Signal should not return error, got: %v\n", err)
+		}
+	}
+	time.Sleep(time.Duration(200) * time.Millisecond)
+	if status := q.Status(); status.Alive != 3 || status.State != nanny.StateWaiting {
+		t.Errorf("group should still have its quorum, got: %+v\n", status)
+	}
+	if msg := memberNotifier.NotifyMsg(); msg.Program != "" {
+		t.Errorf("members should not notify on their own, got: %v\n", msg)
+	}
+	if msg := groupNotifier.NotifyMsg(); msg.Program != "" {
+		t.Errorf("group should not notify with quorum, got: %v\n", msg)
+	}
+
+	silent := members[2]
+	silent.NextSignal = time.Duration(100) * time.Millisecond
+	err = n.Handle(silent)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(200) * time.Millisecond)
+	if status := q.Status(); status.Alive != 2 || status.State != nanny.StateAlerting {
+		t.Errorf("group should alert without quorum, got: %+v\n", status)
+	}
+	msg := groupNotifier.NotifyMsg()
+	if msg.Kind != notifier.KindQuorum || msg.Program != "workers" || msg.Alive != 2 || msg.Members != 5 {
+		t.Errorf("group should notify about lost quorum, got: %v\n", msg)
+	}
+	if !strings.Contains(msg.Format(), `only 2 of 5 members of "workers" are alive, 3 required!`) {
+		t.Errorf("unexpected message, got: %s\n", msg.Format())
+	}
+
+	err = n.Handle(members[0])
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if status := q.Status(); status.Alive != 3 || status.State != nanny.StateRecovered {
+		t.Errorf("group should recover with quorum, got: %+v\n", status)
+	}
+	time.Sleep(time.Duration(50) * time.Millisecond)
+	if msg := groupNotifier.NotifyMsg(); msg.Alive != 3 {
+		t.Errorf("group should send all-clear, got: %v\n", msg)
+	}
+	if msg := memberNotifier.NotifyMsg(); msg.Program != "" {
+		t.Errorf("silent members should not notify on their own, got: %v\n", msg)
+	}
+
+	// Failure of a member is not about being alive, the member notifies.
+	err = n.GetTimer(members[3].Name).Fail(1, "")
+	if err != nil {
+		t.Errorf("timer.Fail should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(50) * time.Millisecond)
+	if msg := memberNotifier.NotifyMsg(); msg.Kind != notifier.KindFailure || msg.Program != members[3].Name {
+		t.Errorf("failed member should notify on its own, got: %v\n", msg)
+	}
+	err = n.Handle(members[3])
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+
+	// Without the group, alerting members notify on their own.
+	if !n.RemoveGroup("workers") {
+		t.Errorf("n.RemoveGroup should remove existing group")
+	}
+	time.Sleep(time.Duration(50) * time.Millisecond)
+	if msg := memberNotifier.NotifyMsg(); msg.Kind != notifier.KindSilent || !strings.HasPrefix(msg.Program, "worker@") {
+		t.Errorf("members should notify after the group was removed, got: %v\n", msg)
+	}
+}
+
+// TestNannyGroupNotifiers tests that group notifications do not block signals and
+// all notifiers are notified in order, even when one of them is slow or fails.
+func TestNannyGroupNotifiers(t *testing.T) {
+	var (
+		errCount int
+		lock     sync.Mutex
+	)
+	errFunc := func(err error) {
+		lock.Lock()
+		errCount++
+		lock.Unlock()
+	}
+	n := nanny.Nanny{Name: "test nanny group notifiers", ErrorFunc: errFunc}
+	blocking := &BlockingNotifier{release: make(chan struct{})}
+	dummy := &DummyNotifier{}
+	err := n.AddGroup(nanny.Group{
+		Name:      "workers",
+		Prefix:    "worker@",
+		MinAlive:  1,
+		Notifier:  blocking,
+		Notifiers: []notifier.Notifier{&DummyNotifierWithError{}, dummy},
+		AllClear:  true,
+	})
+	if err != nil {
+		t.Errorf("n.AddGroup should not return error, got: %v\n", err)
+	}
+	signal := nanny.Signal{
+		Name:       "worker@10.0.0.1",
+		Notifier:   &DummyNotifier{},
+		NextSignal: time.Duration(1) * time.Hour,
+	}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		err := n.GetTimer(signal.Name).Fail(1, "")
+		if err != nil {
+			t.Errorf("timer.Fail should not return error, got: %v\n", err)
+		}
+		err = n.Handle(signal)
+		if err != nil {
+			t.Errorf("n.Signal should not return error, got: %v\n", err)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Duration(1) * time.Second):
+		t.Fatalf("signals should not wait for group notifiers")
+	}
+
+	time.Sleep(time.Duration(50) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Kind != notifier.KindQuorum || msg.Alive != 0 {
+		t.Errorf("group should notify about lost quorum despite slow notifier, got: %v\n", msg)
+	}
+	close(blocking.release)
+	time.Sleep(time.Duration(50) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Alive != 1 {
+		t.Errorf("group should send all-clear after lost quorum, got: %v\n", msg)
+	}
+	if msg := blocking.NotifyMsg(); msg.Alive != 1 {
+		t.Errorf("slow notifier should get all-clear last, got: %v\n", msg)
+	}
+	lock.Lock()
+	if errCount != 2 {
+		t.Errorf("ErrorFunc should be called for each notification of failing notifier, got: %d\n", errCount)
+	}
+	lock.Unlock()
+}
+
+func TestNannyFlapping(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny flapping"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:          "test flapping",
+		Notifier:      dummy,
+		NextSignal:    time.Duration(1) * time.Hour,
+		AllClear:      true,
+		FlapWindow:    time.Duration(1) * time.Hour,
+		FlapThreshold: 3,
+	}
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	timer := n.GetTimer("test flapping")
+
+	// Alert and recovery are notified as usual.
+	err = timer.Fail(1, "")
+	if err != nil {
+		t.Errorf("timer.Fail should not return error, got: %v\n", err)
+	}
+	if msg := dummy.NotifyMsg(); msg.Kind != notifier.KindFailure {
+		t.Errorf("failure should be notified, got: %v\n", msg)
+	}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if msg := dummy.NotifyMsg(); msg.Kind != "" {
+		t.Errorf("all-clear should be notified, got: %v\n", msg)
+	}
+
+	// The third change starts flapping, which is notified once.
+	err = timer.Fail(1, "")
+	if err != nil {
+		t.Errorf("timer.Fail should not return error, got: %v\n", err)
+	}
+	msg := dummy.NotifyMsg()
+	if msg.Kind != notifier.KindFlapping || msg.Changes != 3 {
+		t.Errorf("flapping should be notified, got: %v\n", msg)
+	}
+	if !strings.Contains(msg.Format(), `"test flapping" is flapping, it changed state 3 times in 1h0m0s!`) {
+		t.Errorf("unexpected message, got: %s\n", msg.Format())
+	}
+	if !timer.Status().Flapping {
+		t.Errorf("timer should be flapping")
+	}
+
+	// Neither all-clear nor alerts are sent while flapping.
+	// nolint: errcheck
+	dummy.Notify(notifier.Message{})
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	err = timer.Fail(1, "")
+	if err != nil {
+		t.Errorf("timer.Fail should not return error, got: %v\n", err)
+	}
+	if msg := dummy.NotifyMsg(); msg.Program != "" {
+		t.Errorf("flapping timer should not notify, got: %v\n", msg)
+	}
+	if timer.State() != nanny.StateAlerting {
+		t.Errorf("flapping timer should still change its state, got: %s\n", timer.State())
+	}
+
+	signal.FlapThreshold = 1
+	err = n.Handle(signal)
+	if err == nil {
+		t.Errorf("n.Signal should return error for flap threshold 1")
+	}
+}
+
+func TestNannyStableAllClear(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny stable"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:        "test stable",
+		Notifier:    dummy,
+		NextSignal:  time.Duration(1) * time.Hour,
+		AllClear:    true,
+		StablePings: 3,
+	}
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	timer := n.GetTimer("test stable")
+	err = timer.Fail(1, "")
+	if err != nil {
+		t.Errorf("timer.Fail should not return error, got: %v\n", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		err = n.Handle(signal)
+		if err != nil {
+			t.Errorf("n.Signal should not return error, got: %v\n", err)
+		}
+		if i == 1 && timer.State() != nanny.StateRecovered {
+			t.Errorf("timer should recover right away, got: %s\n", timer.State())
+		}
+		msg := dummy.NotifyMsg()
+		if i < 3 && msg.Kind != notifier.KindFailure {
+			t.Errorf("all-clear should wait for %d pings, sent after %d\n", signal.StablePings, i)
+		}
+		if i == 3 && msg.Kind != "" {
+			t.Errorf("all-clear should be sent after %d pings, got: %v\n", signal.StablePings, msg)
+		}
+	}
+	if timer.Status().AllClearPending {
+		t.Errorf("all-clear should not be pending after it was sent")
+	}
+}
+
+func TestNannyTooEarly(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny early"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:        "test early",
+		Notifier:    dummy,
+		NextSignal:  time.Duration(2) * time.Hour,
+		MinInterval: time.Duration(1) * time.Hour,
+	}
+	for i := 0; i < 2; i++ {
+		err := n.Handle(signal)
+		if err != nil {
+			t.Errorf("n.Signal should not return error, got: %v\n", err)
+		}
+	}
+	msg := dummy.NotifyMsg()
+	if msg.Kind != notifier.KindEarly || msg.NextSignal != signal.MinInterval {
+		t.Errorf("early signal should be notified, got: %v\n", msg)
+	}
+	if !strings.Contains(msg.Format(), `"test early" called too early`) {
+		t.Errorf("unexpected message, got: %s\n", msg.Format())
+	}
+
+	// Notified only once until the program signals as expected.
+	// nolint: errcheck
+	dummy.Notify(notifier.Message{})
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if msg := dummy.NotifyMsg(); msg.Program != "" {
+		t.Errorf("early signal should be notified only once, got: %v\n", msg)
+	}
+	if timer := n.GetTimer("test early"); timer.State() != nanny.StateWaiting || !timer.Status().Early {
+		t.Errorf("early signal should not change state, got: %+v\n", timer.Status())
+	}
+}
+
+func TestNannyTooFrequent(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny frequent"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:       "test frequent",
+		Notifier:   dummy,
+		NextSignal: time.Duration(1) * time.Hour,
+		MaxRate:    2,
+		RateWindow: time.Duration(1) * time.Hour,
+	}
+	for i := 0; i < 2; i++ {
+		err := n.Handle(signal)
+		if err != nil {
+			t.Errorf("n.Signal should not return error, got: %v\n", err)
+		}
+	}
+	if msg := dummy.NotifyMsg(); msg.Program != "" {
+		t.Errorf("signals within rate should not be notified, got: %v\n", msg)
+	}
+
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	msg := dummy.NotifyMsg()
+	if msg.Kind != notifier.KindFrequent || msg.Count != 3 || msg.Limit != 2 {
+		t.Errorf("frequent signal should be notified, got: %v\n", msg)
+	}
+	if !strings.Contains(msg.Format(), `"test frequent" called too frequently, 3 times in 1h0m0s, expected at most 2!`) {
+		t.Errorf("unexpected message, got: %s\n", msg.Format())
+	}
+
+	signal.RateWindow = 0
+	err = n.Handle(signal)
+	if err == nil {
+		t.Errorf("n.Signal should return error for max rate without window")
+	}
+}
+
+func TestNannyInverse(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny inverse"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:     "test inverse",
+		Notifier: dummy,
+		AllClear: true,
+		Inverse:  true,
+		Cooldown: time.Duration(200) * time.Millisecond,
+	}
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(150) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Program != "" {
+		t.Errorf("registration of inverse signal should not be notified, got: %v\n", msg)
+	}
+
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	msg := dummy.NotifyMsg()
+	if msg.Kind != notifier.KindTripped || msg.Format() != `test nanny inverse: "test inverse" was tripped, it should never call!` {
+		t.Errorf("call of inverse signal should be notified, got: %v\n", msg)
+	}
+
+	// nolint: errcheck
+	dummy.Notify(notifier.Message{})
+	time.Sleep(time.Duration(50) * time.Millisecond)
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if msg := dummy.NotifyMsg(); msg.Program != "" {
+		t.Errorf("call within cooldown should not be notified, got: %v\n", msg)
+	}
+	if state := n.GetTimer("test inverse").State(); state != nanny.StateAlerting {
+		t.Errorf("inverse signal should be alerting within cooldown, got: %s\n", state)
+	}
+
+	// The cool-down started again with the last call.
+	time.Sleep(time.Duration(120) * time.Millisecond)
+	if state := n.GetTimer("test inverse").State(); state != nanny.StateAlerting {
+		t.Errorf("inverse signal should be alerting within cooldown, got: %s\n", state)
+	}
+	time.Sleep(time.Duration(150) * time.Millisecond)
+	if state := n.GetTimer("test inverse").State(); state != nanny.StateRecovered {
+		t.Errorf("inverse signal should recover after cooldown, got: %s\n", state)
+	}
+	msg = dummy.NotifyMsg()
+	if msg.FormatAllClear() != `test nanny inverse: "test inverse" did not call for 200ms!` {
+		t.Errorf("unexpected all-clear message, got: %s\n", msg.FormatAllClear())
+	}
+
+	signal.Cooldown = 0
+	err = n.Handle(signal)
+	if err == nil {
+		t.Errorf("n.Signal should return error for inverse signal without cooldown")
+	}
+}
+
+func TestNannyThroughput(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny throughput"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:             "test throughput",
+		Notifier:         dummy,
+		AllClear:         true,
+		MinThroughput:    10,
+		ThroughputWindow: time.Duration(200) * time.Millisecond,
+		Count:            5,
+	}
+	for i := 0; i < 2; i++ {
+		err := n.Handle(signal)
+		if err != nil {
+			t.Errorf("n.Signal should not return error, got: %v\n", err)
+		}
+	}
+	if state := n.GetTimer("test throughput").State(); state != nanny.StateWaiting {
+		t.Errorf("signal with enough events should be waiting, got: %s\n", state)
+	}
+
+	time.Sleep(time.Duration(300) * time.Millisecond)
+	msg := dummy.NotifyMsg()
+	if msg.Kind != notifier.KindThroughput || msg.Format() != `test nanny throughput: "test throughput" reported only 0 events in 200ms, expected at least 10!` {
+		t.Errorf("too few events should be notified, got: %v\n", msg)
+	}
+
+	signal.Count = 4
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if state := n.GetTimer("test throughput").State(); state != nanny.StateAlerting {
+		t.Errorf("signal with too few events should be alerting, got: %s\n", state)
+	}
+
+	// Finished run does not count events of the registration again.
+	timer := n.GetTimer("test throughput")
+	err = timer.Start(time.Duration(1) * time.Hour)
+	if err != nil {
+		t.Errorf("timer.Start should not return error, got: %v\n", err)
+	}
+	_, err = timer.Finish()
+	if err != nil {
+		t.Errorf("timer.Finish should not return error, got: %v\n", err)
+	}
+	total := 0
+	for _, tally := range timer.Status().Tally {
+		total += tally.Count
+	}
+	if total != 4 {
+		t.Errorf("finished run should not report any events, got: %d\n", total)
+	}
+
+	signal.Count = 6
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if state := n.GetTimer("test throughput").State(); state != nanny.StateRecovered {
+		t.Errorf("signal with enough events should recover, got: %s\n", state)
+	}
+	msg = dummy.NotifyMsg()
+	if msg.FormatAllClear() != `test nanny throughput: "test throughput" reported 10 events in 200ms again!` {
+		t.Errorf("unexpected all-clear message, got: %s\n", msg.FormatAllClear())
+	}
+
+	timer.Stop()
+
+	// Failed program which keeps calling with too few events misses its
+	// throughput.
+	signal.Name = "test throughput failed"
+	signal.Count = 0
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	timer = n.GetTimer("test throughput failed")
+	err = timer.Fail(1, "")
+	if err != nil {
+		t.Errorf("timer.Fail should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(100) * time.Millisecond)
+	signal.Count = 1
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if msg := dummy.NotifyMsg(); msg.Kind != notifier.KindFailure || timer.State() != nanny.StateAlerting {
+		t.Errorf("failed program with too few events should be alerting, got: %v\n", msg)
+	}
+	time.Sleep(time.Duration(200) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Kind != notifier.KindThroughput || msg.Program != "test throughput failed" {
+		t.Errorf("failed program with too few events should be notified, got: %v\n", msg)
+	}
+	timer.Stop()
+
+	signal.ThroughputWindow = 0
+	err = n.Handle(signal)
+	if err == nil {
+		t.Errorf("n.Signal should return error for throughput without window")
+	}
+}
+
+func TestNannyAssertions(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny assertions"}
+	dummy := &DummyNotifier{}
+	records, err := nanny.ParseAssertion("records > 0")
+	if err != nil {
+		t.Fatalf("nanny.ParseAssertion should not return error, got: %v\n", err)
+	}
+	signal := nanny.Signal{
+		Name:       "test assertions",
+		Notifier:   dummy,
+		NextSignal: time.Duration(1) * time.Hour,
+		AllClear:   true,
+		Values:     map[string]float64{"records": 10},
+		Assertions: []nanny.Assertion{records},
+	}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if msg := dummy.NotifyMsg(); msg.Program != "" {
+		t.Errorf("signal passing assertions should not be notified, got: %v\n", msg)
+	}
+
+	signal.Values = map[string]float64{"records": 0}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	msg := dummy.NotifyMsg()
+	if msg.Kind != notifier.KindAssertion || msg.Format() != `test nanny assertions: "test assertions" failed its assertion: records = 0, expected records > 0!` {
+		t.Errorf("signal failing assertion should be notified, got: %v\n", msg)
+	}
+	if state := n.GetTimer("test assertions").State(); state != nanny.StateAlerting {
+		t.Errorf("signal failing assertion should be alerting, got: %s\n", state)
+	}
+
+	// Finished run does not pass the failed assertion with values of the
+	// registration.
+	timer := n.GetTimer("test assertions")
+	err = timer.Start(time.Duration(1) * time.Hour)
+	if err != nil {
+		t.Errorf("timer.Start should not return error, got: %v\n", err)
+	}
+	_, err = timer.Finish()
+	if err != nil {
+		t.Errorf("timer.Finish should not return error, got: %v\n", err)
+	}
+	if state := timer.State(); state != nanny.StateAlerting {
+		t.Errorf("finished run should not pass failed assertion, got: %s\n", state)
+	}
+	if values := timer.Status().Values; values["records"] != 0 {
+		t.Errorf("finished run should keep reported values, got: %v\n", values)
+	}
+
+	signal.Values = map[string]float64{"errors": 1}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if msg := dummy.NotifyMsg(); msg.Assertion != "records was not reported, expected records > 0" {
+		t.Errorf("missing value should fail assertion, got: %v\n", msg)
+	}
+
+	signal.Values = map[string]float64{"records": 5}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if state := n.GetTimer("test assertions").State(); state != nanny.StateRecovered {
+		t.Errorf("signal passing assertions should recover, got: %s\n", state)
+	}
+
+	// Calls without values keep the failed assertion, but the program is still
+	// watched for silence.
+	signal.Name = "test assertions silent"
+	signal.NextSignal = time.Duration(100) * time.Millisecond
+	signal.Values = map[string]float64{"records": 0}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	timer = n.GetTimer("test assertions silent")
+	deadline := timer.Status().NextSignal
+	time.Sleep(time.Duration(60) * time.Millisecond)
+	signal.Values = nil
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if status := timer.Status(); status.State != nanny.StateAlerting || status.Kind != notifier.KindAssertion {
+		t.Errorf("call without values should not pass failed assertion, got: %s %s\n", status.State, status.Kind)
+	}
+	if next := timer.Status().NextSignal; !next.After(deadline) {
+		t.Errorf("call without values should move the next signal, got: %v, was: %v\n", next, deadline)
+	}
+	time.Sleep(time.Duration(200) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Kind != notifier.KindSilent || msg.Program != "test assertions silent" {
+		t.Errorf("program failing assertion should be notified when it stops calling, got: %v\n", msg)
+	}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if msg := dummy.NotifyMsg(); msg.Kind != notifier.KindAssertion {
+		t.Errorf("call without values should not pass failed assertion of silent program, got: %v\n", msg)
+	}
+	signal.Values = map[string]float64{"records": 5}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if state := timer.State(); state != nanny.StateRecovered {
+		t.Errorf("signal passing assertions should recover, got: %s\n", state)
+	}
+	timer.Stop()
+
+	for _, expr := range []string{"records", "records >", "> 0", "records ~ 0", "records > zero"} {
+		_, err = nanny.ParseAssertion(expr)
+		if err == nil {
+			t.Errorf("nanny.ParseAssertion should return error for %q", expr)
+		}
+	}
+	a, err := nanny.ParseAssertion("lag<=1.5")
+	if err != nil || a.String() != "lag <= 1.5" {
+		t.Errorf("unexpected assertion, got: %v, %v\n", a, err)
+	}
+}
+
+func TestNannyStalled(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny stalled"}
+	dummy := &DummyNotifier{}
+	progress := func(p float64) *float64 { return &p }
+	signal := nanny.Signal{
+		Name:       "test stalled",
+		Notifier:   dummy,
+		NextSignal: time.Duration(1) * time.Hour,
+		StallAfter: time.Duration(150) * time.Millisecond,
+		Progress:   progress(1),
+	}
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+
+	time.Sleep(time.Duration(100) * time.Millisecond)
+	signal.Progress = progress(2)
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(100) * time.Millisecond)
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if msg := dummy.NotifyMsg(); msg.Program != "" {
+		t.Errorf("moving progress should not be notified, got: %v\n", msg)
+	}
+
+	time.Sleep(time.Duration(100) * time.Millisecond)
+	msg := dummy.NotifyMsg()
+	if msg.Kind != notifier.KindStalled || msg.Format() != `test nanny stalled: "test stalled" is stalled, its progress did not move from 2 in 150ms!` {
+		t.Errorf("stalled progress should be notified, got: %v\n", msg)
+	}
+
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if state := n.GetTimer("test stalled").State(); state != nanny.StateAlerting {
+		t.Errorf("signal without progress should be alerting, got: %s\n", state)
+	}
+
+	signal.Progress = progress(3)
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if state := n.GetTimer("test stalled").State(); state != nanny.StateRecovered {
+		t.Errorf("signal with moving progress should recover, got: %s\n", state)
+	}
+
+	// Finished run does not move progress back to the registration's one.
+	timer := n.GetTimer("test stalled")
+	before := timer.Status()
+	err = timer.Start(time.Duration(1) * time.Hour)
+	if err != nil {
+		t.Errorf("timer.Start should not return error, got: %v\n", err)
+	}
+	_, err = timer.Finish()
+	if err != nil {
+		t.Errorf("timer.Finish should not return error, got: %v\n", err)
+	}
+	after := timer.Status()
+	if after.Progress != 3 || !after.ProgressedAt.Equal(before.ProgressedAt) {
+		t.Errorf("finished run should keep progress, got: %v at %s\n", after.Progress, after.ProgressedAt)
+	}
+	timer.Stop()
+
+	// Silent program which calls again without moving progress is stalled, it is
+	// still watched for silence.
+	signal.Name = "test stalled silent"
+	signal.NextSignal = time.Duration(100) * time.Millisecond
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(200) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Kind != notifier.KindSilent || msg.Program != "test stalled silent" {
+		t.Errorf("silent program should be notified, got: %v\n", msg)
+	}
+	timer = n.GetTimer("test stalled silent")
+	deadline := timer.Status().NextSignal
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if msg := dummy.NotifyMsg(); msg.Kind != notifier.KindStalled {
+		t.Errorf("silent program calling without moving progress should be stalled, got: %v\n", msg)
+	}
+	if status := timer.Status(); status.State != nanny.StateAlerting || !status.NextSignal.After(deadline) {
+		t.Errorf("stalled program should be alerting with moved next signal, got: %s %v\n", status.State, status.NextSignal)
+	}
+	time.Sleep(time.Duration(200) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Kind != notifier.KindSilent {
+		t.Errorf("stalled program should be notified when it stops calling, got: %v\n", msg)
+	}
+	signal.Progress = progress(4)
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if state := timer.State(); state != nanny.StateRecovered {
+		t.Errorf("signal with moving progress should recover, got: %s\n", state)
+	}
+	timer.Stop()
+}
+
+func TestNannyRuntimeAnomaly(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny anomaly"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:          "test anomaly",
+		Notifier:      dummy,
+		NextSignal:    time.Duration(1) * time.Hour,
+		RuntimeFactor: 2,
+	}
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	timer := n.GetTimer("test anomaly")
+
+	// Too few runs to know how long they usually take.
+	for i := 0; i < 5; i++ {
+		err = timer.Start(0)
+		if err != nil {
+			t.Fatalf("timer.Start should not return error, got: %v\n", err)
+		}
+		time.Sleep(time.Duration(20) * time.Millisecond)
+		_, err = timer.Finish()
+		if err != nil {
+			t.Errorf("timer.Finish should not return error, got: %v\n", err)
+		}
+	}
+	if msg := dummy.NotifyMsg(); msg.Program != "" {
+		t.Errorf("usual runs should not be notified, got: %v\n", msg)
+	}
+	stats := timer.RunStats()
+	if stats.Runs != 5 || stats.P95 < time.Duration(20)*time.Millisecond || stats.AnomalyAfter != 2*stats.P95 {
+		t.Errorf("unexpected run statistics, got: %+v\n", stats)
+	}
+
+	err = timer.Start(0)
+	if err != nil {
+		t.Fatalf("timer.Start should not return error, got: %v\n", err)
+	}
+	time.Sleep(stats.AnomalyAfter + time.Duration(50)*time.Millisecond)
+	msg := dummy.NotifyMsg()
+	if msg.Kind != notifier.KindAnomaly || msg.NextSignal != stats.AnomalyAfter {
+		t.Errorf("anomalous run should be notified, got: %v\n", msg)
+	}
+	if !strings.Contains(msg.Format(), `"test anomaly" started, but did not finish in`) {
+		t.Errorf("unexpected message, got: %s\n", msg.Format())
+	}
+
+	signal.RuntimeFactor = 0.5
+	err = n.Handle(signal)
+	if err == nil {
+		t.Errorf("n.Signal should return error for runtime factor below 1")
+	}
+}
+
+func TestNannyLearn(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny learn"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:       "test learn",
+		Notifier:   dummy,
+		LearnPings: 3,
+	}
+	err := n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+
+	// Learning timer does not expect any signal.
+	time.Sleep(time.Duration(300) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Program != "" {
+		t.Errorf("learning signal should not be notified, got: %v\n", msg)
+	}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	time.Sleep(time.Duration(300) * time.Millisecond)
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+
+	status := n.GetTimer("test learn").Status()
+	if status.LearnedInterval < time.Duration(300)*time.Millisecond || status.LearnedInterval > time.Duration(400)*time.Millisecond {
+		t.Errorf("interval should be learned, got: %s\n", status.LearnedInterval)
+	}
+	if status.LearnedGrace < status.LearnedInterval/10 {
+		t.Errorf("tolerance should be at least a tenth of the interval, got: %s\n", status.LearnedGrace)
+	}
+
+	time.Sleep(time.Duration(500) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Kind != notifier.KindSilent || msg.Program != "test learn" {
+		t.Errorf("signal silent for longer than learned interval should be notified, got: %v\n", msg)
+	}
+
+	err = n.GetTimer("test learn").SetInterval(time.Duration(1)*time.Hour, time.Duration(10)*time.Minute)
+	if err != nil {
+		t.Errorf("SetInterval should not return error, got: %v\n", err)
+	}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if state := n.GetTimer("test learn").State(); state != nanny.StateRecovered {
+		t.Errorf("signal should recover, got: %s\n", state)
+	}
+	if status := n.GetTimer("test learn").Status(); status.NextSignal.Before(time.Now().Add(time.Duration(59) * time.Minute)) {
+		t.Errorf("overridden interval should be used, got next signal: %s\n", status.NextSignal)
+	}
+
+	signal = nanny.Signal{Name: "test fixed", Notifier: dummy, NextSignal: time.Duration(1) * time.Hour}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	if err := n.GetTimer("test fixed").SetInterval(time.Duration(1)*time.Hour, 0); err == nil {
+		t.Errorf("SetInterval of signal with explicit interval should return error\n")
+	}
+	if err := n.Handle(nanny.Signal{Name: "test short", Notifier: dummy, LearnPings: 2}); err == nil {
+		t.Errorf("n.Signal should return error for too few learn pings\n")
+	}
+}
+
+func TestNannyIntervalRules(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny rules"}
+	dummy := &DummyNotifier{}
+	now := time.Now().UTC()
+	today := now.Weekday()
+	tomorrow := (today + 1) % 7
+	clock := now.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+	day := time.Duration(24) * time.Hour
+
+	holidays, err := calendar.Parse("test", strings.NewReader(
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;VALUE=DATE:"+now.Format("20060102")+"\nEND:VEVENT\nEND:VCALENDAR\n"))
+	if err != nil {
+		t.Fatalf("calendar.Parse should not return error, got: %v\n", err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		rules    []nanny.IntervalRule
+		holidays *calendar.Calendar
+		expected time.Duration
+	}{
+		{"no match", []nanny.IntervalRule{
+			{Weekdays: []time.Weekday{tomorrow}, NextSignal: time.Duration(5) * time.Minute},
+		}, nil, time.Duration(1) * time.Hour},
+		{"weekday", []nanny.IntervalRule{
+			{Weekdays: []time.Weekday{tomorrow}, NextSignal: time.Duration(5) * time.Minute},
+			{Weekdays: []time.Weekday{today}, NextSignal: time.Duration(10) * time.Minute},
+		}, nil, time.Duration(10) * time.Minute},
+		{"time of day", []nanny.IntervalRule{
+			{From: (clock + time.Hour) % day, To: (clock + 2*time.Hour) % day, NextSignal: time.Duration(5) * time.Minute},
+			{From: (clock + 23*time.Hour) % day, To: (clock + time.Hour) % day, NextSignal: time.Duration(15) * time.Minute},
+		}, nil, time.Duration(15) * time.Minute},
+		{"holiday", []nanny.IntervalRule{
+			{Weekdays: []time.Weekday{today}, NextSignal: time.Duration(5) * time.Minute},
+			{Holidays: true, NextSignal: time.Duration(2) * time.Hour},
+		}, holidays, time.Duration(2) * time.Hour},
+		{"holiday without rule", []nanny.IntervalRule{
+			{Weekdays: []time.Weekday{today}, NextSignal: time.Duration(5) * time.Minute},
+		}, holidays, time.Duration(1) * time.Hour},
+	} {
+		signal := nanny.Signal{
+			Name:       "test rules " + test.name,
+			Notifier:   dummy,
+			NextSignal: time.Duration(1) * time.Hour,
+			Rules:      test.rules,
+			Holidays:   test.holidays,
+		}
+		err := n.Handle(signal)
+		if err != nil {
+			t.Errorf("n.Signal should not return error, got: %v\n", err)
+			continue
+		}
+		status := n.GetTimer(signal.Name).Status()
+		if got := status.NextSignal.Sub(status.LastSignal); got != test.expected {
+			t.Errorf("%s: next signal should be expected after %s, got: %s\n", test.name, test.expected, got)
+		}
+	}
+
+	for _, signal := range []nanny.Signal{
+		{Name: "test rules invalid", Notifier: dummy, NextSignal: time.Hour, Rules: []nanny.IntervalRule{{}}},
+		{Name: "test rules inverse", Notifier: dummy, Inverse: true, Cooldown: time.Hour, Rules: []nanny.IntervalRule{{NextSignal: time.Hour}}},
+		{Name: "test rules holidays", Notifier: dummy, NextSignal: time.Hour, Holidays: holidays},
+	} {
+		if err := n.Handle(signal); err == nil {
+			t.Errorf("n.Signal should return error for %s\n", signal.Name)
+		}
+	}
+}
+
+func TestNannyExpect(t *testing.T) {
+	n := nanny.Nanny{Name: "test nanny expect"}
+	dummy := &DummyNotifier{}
+	signal := nanny.Signal{
+		Name:       "test expect",
+		Notifier:   dummy,
+		NextSignal: time.Duration(1) * time.Hour,
+	}
+	err := n.Expect(signal, time.Duration(100)*time.Millisecond)
+	if err != nil {
+		t.Errorf("n.Expect should not return error, got: %v\n", err)
+	}
+	status := n.GetTimer("test expect").Status()
+	if !status.LastSignal.IsZero() {
+		t.Errorf("expected signal should not have last signal, got: %s\n", status.LastSignal)
+	}
+
+	// Program which never called is notified after the first deadline.
+	time.Sleep(time.Duration(200) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Kind != notifier.KindSilent || msg.Program != "test expect" {
+		t.Errorf("program not calling by the first deadline should be notified, got: %v\n", msg)
+	}
+
+	// Registered timer keeps its state, only settings are updated.
+	signal.Grace = time.Duration(1) * time.Minute
+	err = n.Expect(signal, time.Duration(1)*time.Hour)
+	if err != nil {
+		t.Errorf("n.Expect should not return error, got: %v\n", err)
+	}
+	timer := n.GetTimer("test expect")
+	if state := timer.State(); state != nanny.StateAlerting {
+		t.Errorf("expected signal should keep its state, got: %s\n", state)
+	}
+	if grace := timer.Signal().Grace; grace != signal.Grace {
+		t.Errorf("expected signal should update its settings, got grace: %s\n", grace)
+	}
+
+	// Zero first deadline means the usual deadline.
+	signal.Name = "test expect usual"
+	err = n.Expect(signal, 0)
+	if err != nil {
+		t.Errorf("n.Expect should not return error, got: %v\n", err)
+	}
+	next := n.GetTimer("test expect usual").Status().NextSignal
+	if until := time.Until(next); until < time.Duration(59)*time.Minute || until > time.Duration(1)*time.Hour {
+		t.Errorf("first signal should be expected within next signal, got: %s\n", next)
+	}
+
+	// Changed interval of registered timer moves its deadline right away.
+	signal = nanny.Signal{Name: "test expect changed", Notifier: dummy, NextSignal: time.Duration(1) * time.Hour}
+	err = n.Handle(signal)
+	if err != nil {
+		t.Errorf("n.Signal should not return error, got: %v\n", err)
+	}
+	last := n.GetTimer(signal.Name).Status().LastSignal
+	signal.NextSignal = time.Duration(100) * time.Millisecond
+	err = n.Expect(signal, time.Duration(1)*time.Hour)
+	if err != nil {
+		t.Errorf("n.Expect should not return error, got: %v\n", err)
+	}
+	status = n.GetTimer(signal.Name).Status()
+	if !status.LastSignal.Equal(last) || !status.NextSignal.Equal(last.Add(signal.NextSignal)) {
+		t.Errorf("deadline should be counted from the last signal, got: %+v\n", status)
+	}
+	time.Sleep(time.Duration(200) * time.Millisecond)
+	if msg := dummy.NotifyMsg(); msg.Program != signal.Name {
+		t.Errorf("program should be notified after the changed deadline, got: %v\n", msg)
+	}
+
+	// Unchanged settings keep the deadline of program which never called.
+	signal = nanny.Signal{Name: "test expect unchanged", Notifier: dummy, NextSignal: time.Duration(1) * time.Hour}
+	err = n.Expect(signal, time.Duration(10)*time.Minute)
+	if err != nil {
+		t.Errorf("n.Expect should not return error, got: %v\n", err)
+	}
+	next = n.GetTimer(signal.Name).Status().NextSignal
+	err = n.Expect(signal, time.Duration(20)*time.Minute)
+	if err != nil {
+		t.Errorf("n.Expect should not return error, got: %v\n", err)
+	}
+	if status := n.GetTimer(signal.Name).Status(); !status.NextSignal.Equal(next) {
+		t.Errorf("unchanged signal should keep its deadline, got: %s\n", status.NextSignal)
+	}
+
+	// Overridden interval of learning program which never called counts from now.
+	signal = nanny.Signal{Name: "test expect learn", Notifier: dummy, LearnPings: 3}
+	err = n.Expect(signal, 0)
+	if err != nil {
+		t.Errorf("n.Expect should not return error, got: %v\n", err)
+	}
+	timer = n.GetTimer(signal.Name)
+	err = timer.SetInterval(time.Duration(1)*time.Hour, 0)
+	if err != nil {
+		t.Errorf("timer.SetInterval should not return error, got: %v\n", err)
+	}
+	status = timer.Status()
+	if until := time.Until(status.NextSignal); status.State != nanny.StateWaiting || until < time.Duration(59)*time.Minute {
+		t.Errorf("overridden interval should be counted from now, got: %+v\n", status)
+	}
+
+	// Scheduled program and program with interval rules which never called are
+	// reported with time since they are expected.
+	schedule, err := cron.Parse("0 2 * * *")
+	if err != nil {
+		t.Fatalf("cron.Parse should not return error, got: %v\n", err)
+	}
+	rules := []nanny.IntervalRule{{Weekdays: []time.Weekday{time.Now().UTC().Weekday()}, NextSignal: time.Duration(5) * time.Minute}}
+	for _, signal := range []nanny.Signal{
+		{Name: "test expect schedule", Notifier: &DummyNotifier{}, Schedule: schedule},
+		{Name: "test expect rules", Notifier: &DummyNotifier{}, NextSignal: time.Duration(1) * time.Hour, Rules: rules},
+	} {
+		err = n.Expect(signal, time.Duration(100)*time.Millisecond)
+		if err != nil {
+			t.Errorf("n.Expect should not return error, got: %v\n", err)
+		}
+		time.Sleep(time.Duration(200) * time.Millisecond)
+		msg := signal.Notifier.(*DummyNotifier).NotifyMsg()
+		if msg.Program != signal.Name || msg.NextSignal < 0 || msg.NextSignal > time.Duration(1)*time.Second {
+			t.Errorf("program should be reported with time since it is expected, got: %v\n", msg)
+		}
+	}
+}
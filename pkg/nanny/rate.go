@@ -0,0 +1,73 @@
+package nanny
+
+import (
+	"time"
+
+	"nanny/pkg/notifier"
+)
+
+// checkRate records arrival of a signal and returns notifications about program
+// signalling too early or too frequently. Each of them is sent once, until the
+// program signals as expected again. Must be called with nt.lock held, before
+// LastSignal is updated.
+func (nt *Timer) checkRate(now time.Time) []notifier.Message {
+	var messages []notifier.Message
+
+	if nt.signal.MinInterval > 0 {
+		interval := now.Sub(nt.status.LastSignal)
+		early := !nt.status.LastSignal.IsZero() && interval < nt.signal.MinInterval
+		if early && !nt.status.Early {
+			msg := nt.message()
+			msg.Kind = notifier.KindEarly
+			msg.NextSignal = nt.signal.MinInterval
+			msg.Interval = interval
+			messages = append(messages, msg)
+		}
+		nt.status.Early = early
+	}
+
+	if nt.signal.MaxRate > 0 {
+		nt.status.Arrivals = append(nt.recentArrivals(now), now)
+		frequent := len(nt.status.Arrivals) > nt.signal.MaxRate
+		if frequent && !nt.status.Frequent {
+			msg := nt.message()
+			msg.Kind = notifier.KindFrequent
+			msg.NextSignal = nt.signal.RateWindow
+			msg.Count = len(nt.status.Arrivals)
+			msg.Limit = nt.signal.MaxRate
+			messages = append(messages, msg)
+		}
+		nt.status.Frequent = frequent
+	}
+
+	if len(messages) > 0 && !nt.nanny.silencedUntil(Signal(nt.signal), now).IsZero() {
+		return nil
+	}
+	for i := range messages {
+		messages[i].Reminder = 0
+		messages[i].Dependents = nil
+	}
+	return messages
+}
+
+// recentArrivals returns arrivals within RateWindow. Must be called with nt.lock
+// held.
+func (nt *Timer) recentArrivals(now time.Time) []time.Time {
+	since := now.Add(-nt.signal.RateWindow)
+	i := 0
+	for i < len(nt.status.Arrivals) && !nt.status.Arrivals[i].After(since) {
+		i++
+	}
+	return nt.status.Arrivals[i:]
+}
+
+// warn sends given warnings about early or frequent signals. Must be called
+// without nt.lock held.
+func (nt *Timer) warn(notifiers []notifier.Notifier, warnings []notifier.Message) {
+	for _, warning := range warnings {
+		warning := warning
+		nt.deliver(notifiers, func(notif notifier.Notifier) error {
+			return notif.Notify(warning)
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package nanny
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IntervalRule is interval between signals used when the last signal was received
+// on given days within given time of day, see Signal.Rules.
+type IntervalRule struct {
+	// Days of week the rule applies to, all days including holidays when empty
+	// and Holidays is not set.
+	Weekdays []time.Weekday
+	// The rule applies to holidays of Signal.Holidays. Rules with Weekdays only
+	// do not apply to holidays.
+	Holidays bool
+	// Time of day range since midnight, From inclusive, To exclusive. Range wraps
+	// around midnight when To is not after From, the whole day when they are equal.
+	From, To time.Duration
+	// Interval between signals.
+	NextSignal time.Duration
+}
+
+// dayNames are names of days used by ParseDays, "holiday" marks holidays.
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseDays parses days of week like "mon", ranges like "mon-fri" and "holiday".
+// Range wraps around the end of week when it ends before it starts, e.g.
+// "fri-mon". Returns days of week and whether holidays were given.
+func ParseDays(days []string) ([]time.Weekday, bool, error) {
+	var (
+		weekdays []time.Weekday
+		holidays bool
+		seen     [7]bool
+	)
+	for _, day := range days {
+		day = strings.ToLower(strings.TrimSpace(day))
+		if day == "holiday" {
+			holidays = true
+			continue
+		}
+		from, to := day, day
+		if i := strings.Index(day, "-"); i >= 0 {
+			from, to = day[:i], day[i+1:]
+		}
+		first, last := weekday(from), weekday(to)
+		if first < 0 || last < 0 {
+			return nil, false, errors.Errorf("invalid day: %s", day)
+		}
+		for wd := first; ; wd = (wd + 1) % 7 {
+			if !seen[wd] {
+				seen[wd] = true
+				weekdays = append(weekdays, wd)
+			}
+			if wd == last {
+				break
+			}
+		}
+	}
+	return weekdays, holidays, nil
+}
+
+// weekday returns day of week of its name, -1 for unknown name.
+func weekday(name string) time.Weekday {
+	for i, n := range dayNames {
+		if n == name {
+			return time.Weekday(i)
+		}
+	}
+	return -1
+}
+
+// Days returns names of days the rule applies to, see ParseDays.
+func (r IntervalRule) Days() []string {
+	var days []string
+	for _, wd := range r.Weekdays {
+		days = append(days, dayNames[wd])
+	}
+	if r.Holidays {
+		days = append(days, "holiday")
+	}
+	return days
+}
+
+// MarshalJSON marshals the rule into JSON with fields days, from, to and
+// next_signal.
+func (r IntervalRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Days       []string `json:"days,omitempty"`
+		From       string   `json:"from,omitempty"`
+		To         string   `json:"to,omitempty"`
+		NextSignal string   `json:"next_signal"`
+	}{
+		Days:       r.Days(),
+		From:       formatClock(r.From),
+		To:         formatClock(r.To),
+		NextSignal: r.NextSignal.String(),
+	})
+}
+
+// formatClock formats time of day as "15:04", empty for midnight.
+func formatClock(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return time.Time{}.Add(d).Format("15:04")
+}
+
+// validate checks the rule is usable.
+func (r IntervalRule) validate() error {
+	if r.NextSignal <= 0 {
+		return errors.New("interval rule must have positive next signal")
+	}
+	if r.From < 0 || r.From >= 24*time.Hour || r.To < 0 || r.To >= 24*time.Hour {
+		return errors.New("interval rule time of day must be within a day")
+	}
+	for _, wd := range r.Weekdays {
+		if wd < time.Sunday || wd > time.Saturday {
+			return errors.Errorf("interval rule has invalid day of week: %d", wd)
+		}
+	}
+	return nil
+}
+
+// matches returns true when the rule applies to t, which is in the signal's time
+// zone.
+func (r IntervalRule) matches(t time.Time, holiday bool) bool {
+	hour, min, sec := t.Clock()
+	clock := time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second
+	switch {
+	case r.From < r.To:
+		if clock < r.From || clock >= r.To {
+			return false
+		}
+	case r.From > r.To:
+		if clock < r.From && clock >= r.To {
+			return false
+		}
+	}
+
+	if holiday && r.Holidays {
+		return true
+	}
+	if len(r.Weekdays) == 0 {
+		return !r.Holidays
+	}
+	if holiday {
+		return false
+	}
+	for _, wd := range r.Weekdays {
+		if wd == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// intervalAt returns interval between signals for signal received at t: interval
+// of the first matching rule, or NextSignal when no rule matches.
+func (s validSignal) intervalAt(t time.Time) time.Duration {
+	if len(s.Rules) == 0 {
+		return s.NextSignal
+	}
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	holiday := s.Holidays != nil && s.Holidays.Holiday(t)
+	for _, r := range s.Rules {
+		if r.matches(t, holiday) {
+			return r.NextSignal
+		}
+	}
+	return s.NextSignal
+}
@@ -0,0 +1,141 @@
+package nanny
+
+import (
+	"time"
+
+	"nanny/pkg/notifier"
+
+	"github.com/pkg/errors"
+)
+
+// Start opens a run of the program, e.g. a batch job. If the run is not finished
+// within maxRuntime, user is notified. Signal's MaxRuntime is used when maxRuntime
+// is 0. User is also notified when the run takes much longer than usual, see
+// Signal.RuntimeFactor, the maximum runtime is optional then. Starting new run
+// replaces the current one.
+func (nt *Timer) Start(maxRuntime time.Duration) error {
+	nt.lock.Lock()
+	if maxRuntime == 0 {
+		maxRuntime = nt.signal.MaxRuntime
+	}
+	if maxRuntime < 0 || (maxRuntime == 0 && nt.signal.RuntimeFactor == 0) {
+		nt.lock.Unlock()
+		return errors.New("maximum runtime must be positive")
+	}
+	now := time.Now()
+	nt.status.RunStarted = now
+	nt.status.RunDeadline = time.Time{}
+	if maxRuntime > 0 {
+		nt.status.RunDeadline = now.Add(maxRuntime)
+	}
+	if nt.status.State != StatePaused {
+		nt.armRun()
+	}
+	nt.lock.Unlock()
+
+	nt.nanny.changed(nt)
+	return nil
+}
+
+// Finish closes the current run and records its duration, which is returned.
+// Finished run also counts as a signal, see Reset. Returns error when no run was
+// started.
+func (nt *Timer) Finish() (time.Duration, error) {
+	nt.lock.Lock()
+	if nt.status.RunStarted.IsZero() {
+		nt.lock.Unlock()
+		return 0, errors.New("no run was started")
+	}
+	runtime := time.Since(nt.status.RunStarted)
+	nt.status.LastRuntime = runtime
+	nt.recordRuntime(runtime)
+	nt.status.RunStarted = time.Time{}
+	nt.status.RunDeadline = time.Time{}
+	nt.runTimer.Stop()
+	// Finished run does not report values, progress or events of the signal,
+	// they are not checked or counted again.
+	signal := nt.signal
+	signal.Values = nil
+	signal.Progress = nil
+	signal.Count = 0
+	nt.lock.Unlock()
+
+	nt.Reset(signal)
+	return runtime, nil
+}
+
+// armRun sets the run timer to the current run's deadline, or to when it becomes
+// anomalous if that is sooner, if there is a run. Must be called with nt.lock
+// held.
+func (nt *Timer) armRun() {
+	if nt.status.RunStarted.IsZero() {
+		return
+	}
+	next := nt.status.RunDeadline
+	if anomaly := nt.anomalyDeadline(); !anomaly.IsZero() && (next.IsZero() || anomaly.Before(next)) {
+		next = anomaly
+	}
+	if next.IsZero() {
+		return
+	}
+	nt.runTimer.Reset(time.Until(next))
+}
+
+// onRunExpire is called when the current run exceeds its maximum runtime, or
+// takes much longer than usual.
+func (nt *Timer) onRunExpire() {
+	nt.lock.Lock()
+	now := time.Now()
+	if nt.stopped || nt.status.RunStarted.IsZero() {
+		// Run was finished in the meantime.
+		nt.lock.Unlock()
+		return
+	}
+	kind := notifier.KindRuntime
+	if nt.status.RunDeadline.IsZero() || now.Before(nt.status.RunDeadline) {
+		anomaly := nt.anomalyDeadline()
+		if anomaly.IsZero() || now.Before(anomaly) {
+			// Run was restarted in the meantime.
+			nt.lock.Unlock()
+			return
+		}
+		kind = notifier.KindAnomaly
+	}
+	switch nt.status.State {
+	case StateAlerting, StatePaused:
+		// User was already notified, or does not want to be.
+		nt.lock.Unlock()
+		return
+	}
+
+	nt.timer.Stop()
+	nt.alert(kind)
+	nt.notify(now, true)
+}
+
+// Fail reports failure of the program, user is notified immediately. The timer
+// stays alerting until the program signals again, the current run is closed.
+// Returns error when the timer is paused.
+func (nt *Timer) Fail(exitCode int, log string) error {
+	nt.lock.Lock()
+	if nt.status.State == StatePaused {
+		nt.lock.Unlock()
+		return errors.New("signal is paused")
+	}
+	now := time.Now()
+	first := nt.status.State != StateAlerting
+	nt.status.LastSignal = now
+	if !nt.status.RunStarted.IsZero() {
+		nt.status.LastRuntime = now.Sub(nt.status.RunStarted)
+		nt.status.RunStarted = time.Time{}
+		nt.status.RunDeadline = time.Time{}
+		nt.runTimer.Stop()
+	}
+	nt.status.ExitCode = exitCode
+	nt.status.Log = log
+
+	nt.timer.Stop()
+	nt.alert(notifier.KindFailure)
+	nt.notify(now, first)
+	return nil
+}
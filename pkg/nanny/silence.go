@@ -0,0 +1,223 @@
+package nanny
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"nanny/pkg/cron"
+
+	"github.com/pkg/errors"
+)
+
+// Silence suppresses notifications of matching signals, e.g. during planned
+// maintenance. Signals still become late and alerting, but nobody is notified
+// until the silence ends.
+type Silence struct {
+	ID        string    // Unique ID, generated by AddSilence when empty.
+	Matchers  []Matcher // All matchers must match the signal.
+	Start     time.Time // When the silence starts.
+	End       time.Time // When the silence ends, may be zero for recurring silences.
+	CreatedBy string
+	Comment   string
+
+	// Optional recurring window, the silence is active for Duration after each
+	// time matching Cron between Start and End.
+	Cron     string
+	Duration time.Duration
+	Location *time.Location // Time zone of Cron, UTC when nil.
+
+	schedule *cron.Schedule
+}
+
+// Matcher matches signal name or its meta value.
+type Matcher struct {
+	Meta  string // Meta key to match, signal name is matched when empty.
+	Value string // Glob pattern, or regular expression when Regex is set.
+	Regex bool
+
+	regexp *regexp.Regexp
+}
+
+// Matches returns true if all matchers match the signal.
+func (s *Silence) Matches(signal Signal) bool {
+	for _, m := range s.Matchers {
+		if !m.matches(signal) {
+			return false
+		}
+	}
+	return true
+}
+
+// ActiveUntil returns end of the silence window active at given time, or zero
+// time when the silence is not active.
+func (s *Silence) ActiveUntil(now time.Time) time.Time {
+	if now.Before(s.Start) || (!s.End.IsZero() && !now.Before(s.End)) {
+		return time.Time{}
+	}
+	if s.schedule == nil {
+		return s.End
+	}
+
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	started := s.schedule.Prev(now.In(loc), s.Duration)
+	if started.IsZero() || started.Before(s.Start) {
+		return time.Time{}
+	}
+	end := started.Add(s.Duration)
+	if !now.Before(end) {
+		return time.Time{}
+	}
+	if !s.End.IsZero() && s.End.Before(end) {
+		return s.End
+	}
+	return end
+}
+
+// Expired returns true if the silence will never be active again.
+func (s *Silence) Expired(now time.Time) bool {
+	return !s.End.IsZero() && !now.Before(s.End)
+}
+
+func (m *Matcher) matches(signal Signal) bool {
+	value := signal.Name
+	if m.Meta != "" {
+		var ok bool
+		value, ok = signal.Meta[m.Meta]
+		if !ok {
+			return false
+		}
+	}
+	if m.regexp != nil {
+		return m.regexp.MatchString(value)
+	}
+	ok, _ := path.Match(m.Value, value)
+	return ok
+}
+
+// validateSilence does sanity check and compiles matchers and schedule.
+func validateSilence(s Silence) (*Silence, error) {
+	if len(s.Matchers) == 0 {
+		return nil, errors.New("silence must have at least one matcher")
+	}
+	matchers := make([]Matcher, len(s.Matchers))
+	for i, m := range s.Matchers {
+		if m.Regex {
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return nil, errors.Wrapf(err, "silence.Matchers[%d] is invalid", i)
+			}
+			m.regexp = re
+		} else if _, err := path.Match(m.Value, ""); err != nil {
+			return nil, errors.Wrapf(err, "silence.Matchers[%d] is invalid", i)
+		}
+		matchers[i] = m
+	}
+	s.Matchers = matchers
+
+	if !s.End.IsZero() && !s.End.After(s.Start) {
+		return nil, errors.New("silence.End must be after silence.Start")
+	}
+	if s.Cron == "" {
+		if s.End.IsZero() {
+			return nil, errors.New("silence.End must be set for silence which is not recurring")
+		}
+		s.schedule = nil
+		return &s, nil
+	}
+
+	schedule, err := cron.Parse(s.Cron)
+	if err != nil {
+		return nil, errors.Wrap(err, "silence.Cron is invalid")
+	}
+	if s.Duration <= 0 {
+		return nil, errors.New("silence.Duration must be positive for recurring silence")
+	}
+	s.schedule = schedule
+	return &s, nil
+}
+
+// AddSilence adds new silence, or replaces existing silence with the same ID.
+// The stored silence is returned, with ID generated if it was empty.
+func (n *Nanny) AddSilence(s Silence) (Silence, error) {
+	vs, err := validateSilence(s)
+	if err != nil {
+		return s, errors.Wrap(err, "silence is invalid")
+	}
+	if vs.ID == "" {
+		vs.ID, err = newID()
+		if err != nil {
+			return s, err
+		}
+	}
+	n.silences.Set(vs.ID, vs)
+	n.recheckSuppressed()
+	return *vs, nil
+}
+
+// GetSilence returns silence with given ID.
+func (n *Nanny) GetSilence(id string) (Silence, bool) {
+	value, ok := n.silences.GetStringKey(id)
+	if !ok {
+		return Silence{}, false
+	}
+	return *value.(*Silence), true
+}
+
+// RemoveSilence removes silence with given ID. Returns false if there is no such
+// silence.
+func (n *Nanny) RemoveSilence(id string) bool {
+	if _, ok := n.silences.GetStringKey(id); !ok {
+		return false
+	}
+	n.silences.Del(id)
+	n.recheckSuppressed()
+	return true
+}
+
+// GetSilences returns all silences, ordered by their start.
+func (n *Nanny) GetSilences() []Silence {
+	var silences []Silence
+	for item := range n.silences.Iter() {
+		silences = append(silences, *item.Value.(*Silence))
+	}
+	sort.Slice(silences, func(i, j int) bool {
+		if silences[i].Start.Equal(silences[j].Start) {
+			return silences[i].ID < silences[j].ID
+		}
+		return silences[i].Start.Before(silences[j].Start)
+	})
+	return silences
+}
+
+// silencedUntil returns end of the silence window suppressing notifications of
+// given signal, or zero time if the signal is not silenced.
+func (n *Nanny) silencedUntil(signal Signal, now time.Time) time.Time {
+	var until time.Time
+	for item := range n.silences.Iter() {
+		s := item.Value.(*Silence)
+		if end := s.ActiveUntil(now); !end.IsZero() && s.Matches(signal) {
+			// The earliest end, silences are checked again afterwards.
+			if until.IsZero() || end.Before(until) {
+				until = end
+			}
+		}
+	}
+	return until
+}
+
+// newID generates random ID.
+func newID() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to generate ID")
+	}
+	return hex.EncodeToString(b), nil
+}
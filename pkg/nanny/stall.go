@@ -0,0 +1,55 @@
+package nanny
+
+import (
+	"time"
+
+	"nanny/pkg/notifier"
+)
+
+// progress records progress reported by a signal and returns false when the
+// program is stalled, its progress did not move within StallAfter. Progress
+// lower than the previous one means the program started again, it counts as
+// moved. Must be called with nt.lock held.
+func (nt *Timer) progress(now time.Time, progress *float64) bool {
+	if nt.status.ProgressedAt.IsZero() ||
+		(progress != nil && *progress != nt.status.Progress) {
+		if progress != nil {
+			nt.status.Progress = *progress
+		}
+		nt.status.ProgressedAt = now
+		nt.armStall()
+	}
+	return now.Before(nt.status.ProgressedAt.Add(nt.signal.StallAfter))
+}
+
+// armStall sets the stall timer to when the program is stalled if its progress
+// does not move. Must be called with nt.lock held.
+func (nt *Timer) armStall() {
+	if nt.signal.StallAfter == 0 {
+		return
+	}
+	nt.stallTimer.Reset(time.Until(nt.status.ProgressedAt.Add(nt.signal.StallAfter)))
+}
+
+// onStallExpire is called when progress of the program did not move within
+// StallAfter.
+func (nt *Timer) onStallExpire() {
+	nt.lock.Lock()
+	now := time.Now()
+	if nt.stopped || nt.signal.StallAfter == 0 ||
+		now.Before(nt.status.ProgressedAt.Add(nt.signal.StallAfter)) {
+		// Progress moved in the meantime.
+		nt.lock.Unlock()
+		return
+	}
+	switch nt.status.State {
+	case StateAlerting, StatePaused:
+		// User was already notified, or does not want to be.
+		nt.lock.Unlock()
+		return
+	}
+
+	nt.timer.Stop()
+	nt.alert(notifier.KindStalled)
+	nt.notify(now, true)
+}
@@ -0,0 +1,95 @@
+package nanny
+
+import (
+	"time"
+
+	"nanny/pkg/notifier"
+)
+
+// State represents lifecycle state of a Timer.
+type State string
+
+const (
+	// StateWaiting means the program signalled and nanny waits for the next signal.
+	StateWaiting State = "waiting"
+	// StateLate means NextSignal passed, but the program is within its grace period.
+	StateLate State = "late"
+	// StateAlerting means the program did not signal in time and user was notified.
+	StateAlerting State = "alerting"
+	// StateRecovered means the program signalled again after alerting.
+	StateRecovered State = "recovered"
+	// StatePaused means the timer is paused and will not notify until resumed.
+	StatePaused State = "paused"
+)
+
+// Status is a snapshot of the Timer's lifecycle. It is used to persist the timer
+// and to restore it after restart, see Nanny.Restore.
+type Status struct {
+	State       State
+	NextSignal  time.Time     // When the next signal is expected, without grace period.
+	LastSignal  time.Time     // When the program signalled last time.
+	AlertedAt   time.Time     // When the user was notified the first time during last alert.
+	RecoveredAt time.Time     // When the program signalled after last alert.
+	NotifiedAt  time.Time     // When the last notification (or reminder) was sent.
+	Step        int           // Current escalation step, 0 is the signal's Notifier.
+	Reminders   int           // How many notifications were sent after the first one.
+	Ack         Ack           // Acknowledgement of the current alert, if any.
+	Kind        notifier.Kind // Kind of the current alert.
+
+	RunStarted  time.Time     // When the current run started, zero when there is no run.
+	RunDeadline time.Time     // When the current run must finish.
+	LastRuntime time.Duration // How long the last finished run took.
+	// Runtimes of the last finished runs, oldest first, see RunHistory.
+	Runtimes []time.Duration
+
+	ExitCode int    // Exit code of the last reported failure.
+	Log      string // Log excerpt of the last reported failure.
+
+	Transitions []time.Time // Changes between alerting and recovered within FlapWindow.
+	Flapping    bool        // Whether the timer is flapping, see Signal.FlapThreshold.
+
+	AllClearPending bool      // All-clear is sent once the recovered timer is stable.
+	StableSince     time.Time // When the timer started to be stable.
+	Pings           int       // Signals since StableSince.
+
+	Arrivals []time.Time // Signals within RateWindow.
+	Early    bool        // Whether the last signal came sooner than MinInterval.
+	Frequent bool        // Whether there are more than MaxRate signals within RateWindow.
+
+	Tally []Tally // Events reported within ThroughputWindow.
+
+	Values    map[string]float64 // Values reported by the last signal.
+	Assertion string             // Description of the last failed assertion.
+
+	Progress     float64   // Progress reported by the last signal, see Signal.StallAfter.
+	ProgressedAt time.Time // When the progress moved last time.
+
+	Intervals       []time.Duration // Intervals between signals observed while learning, see Signal.LearnPings.
+	LearnedInterval time.Duration   // Learned interval between signals, zero while learning.
+	LearnedGrace    time.Duration   // Learned tolerance of the interval.
+}
+
+// Tally is number of events reported by one signal, see Signal.MinThroughput.
+type Tally struct {
+	At    time.Time
+	Count int
+}
+
+// Ack represents user acknowledging an alerting timer. Acknowledged timer does
+// not send reminders nor escalates until the acknowledgement expires, all-clear
+// notification is still sent when the program recovers.
+type Ack struct {
+	By    string    // Who acknowledged the alert.
+	Note  string    // Optional note, e.g. what is being done.
+	At    time.Time // When the alert was acknowledged.
+	Until time.Time // Optional expiry, zero means until the program recovers.
+}
+
+// Active returns true if the acknowledgement is set and did not expire at given
+// time.
+func (a Ack) Active(now time.Time) bool {
+	if a.At.IsZero() {
+		return false
+	}
+	return a.Until.IsZero() || now.Before(a.Until)
+}
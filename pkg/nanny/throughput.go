@@ -0,0 +1,50 @@
+package nanny
+
+import (
+	"time"
+)
+
+// count records events reported by a signal and returns true when there are at
+// least MinThroughput events within ThroughputWindow. Must be called with nt.lock
+// held.
+func (nt *Timer) count(now time.Time, events int) bool {
+	nt.status.Tally = append(nt.recentTally(now), Tally{At: now, Count: events})
+	return nt.throughput(now) >= nt.signal.MinThroughput
+}
+
+// throughput returns number of events reported within ThroughputWindow. Must be
+// called with nt.lock held.
+func (nt *Timer) throughput(now time.Time) int {
+	total := 0
+	for _, tally := range nt.recentTally(now) {
+		total += tally.Count
+	}
+	return total
+}
+
+// recentTally returns tallies within ThroughputWindow. Must be called with
+// nt.lock held.
+func (nt *Timer) recentTally(now time.Time) []Tally {
+	since := now.Add(-nt.signal.ThroughputWindow)
+	i := 0
+	for i < len(nt.status.Tally) && !nt.status.Tally[i].At.After(since) {
+		i++
+	}
+	return nt.status.Tally[i:]
+}
+
+// throughputDeadline returns when the number of events within ThroughputWindow
+// drops below MinThroughput, if no other events are reported. The program has
+// the whole window to report them when there are too few events yet. Must be
+// called with nt.lock held.
+func (nt *Timer) throughputDeadline(now time.Time) time.Time {
+	tally := nt.recentTally(now)
+	total := 0
+	for i := len(tally) - 1; i >= 0; i-- {
+		total += tally[i].Count
+		if total >= nt.signal.MinThroughput {
+			return tally[i].At.Add(nt.signal.ThroughputWindow)
+		}
+	}
+	return now.Add(nt.signal.ThroughputWindow)
+}
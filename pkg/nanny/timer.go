@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"nanny/pkg/notifier"
@@ -13,85 +14,995 @@ import (
 
 // Timer encapsulates a signal and its timer
 type Timer struct {
-	signal validSignal
-	timer  *time.Timer
-	nanny  *Nanny
-	end    time.Time
+	signal   validSignal
+	timer    *time.Timer
+	runTimer *time.Timer // Fires when the current run exceeds its maximum runtime.
+	// Fires when progress of the program does not move within StallAfter.
+	stallTimer *time.Timer
+	nanny      *Nanny
+	status     Status // Lifecycle state of this timer.
+
+	stopped     bool  // Timer was stopped and must not notify anymore.
+	suppressed  bool  // Last notification was suppressed by a silence, alerting dependency or group.
+	alerting    int32 // 1 when alerting, may be read without lock by dependent timers.
+	flapStarted bool  // Timer started flapping with the last alert and user was not notified yet.
+	// Since when the first signal of program which never called is expected, see
+	// Expect.
+	expected time.Time
 
 	lock sync.Mutex
 }
 
-// MarshalJSON marshals a nanny.Timer into JSON. Fields name, notifier, next_signal, all_clear and meta are exported
+// MarshalJSON marshals a nanny.Timer into JSON. Fields name, type, notifier, notifiers, next_signal, grace,
+// state, late, last_signal, alerted_at, recovered_at, all_clear, meta, identity, reminders, escalation_step,
+// ack, alert, depends_on and group are exported, settings and state of optional features are exported in
+// sections rules, runs, silences, checks and learning, which are left out when the signal does not use them.
 func (nt *Timer) MarshalJSON() ([]byte, error) {
+	nt.lock.Lock()
+	defer nt.lock.Unlock()
+
+	var notifiers []string
+	if len(nt.signal.Notifiers) > 0 {
+		for _, notif := range nt.stepNotifiers(0) {
+			notifiers = append(notifiers, notif.String())
+		}
+	}
+	signalType := "heartbeat"
+	switch {
+	case nt.signal.Inverse:
+		signalType = "inverse"
+	case nt.signal.MinThroughput > 0:
+		signalType = "throughput"
+	}
 	return json.Marshal(&struct {
-		Name       string            `json:"name"`
-		Notifier   string            `json:"notifier"`
-		NextSignal string            `json:"next_signal"`
-		AllClear   bool              `json:"all_clear"`
-		Meta       map[string]string `json:"meta,omitempty"`
+		Name        string            `json:"name"`
+		Type        string            `json:"type"`
+		Notifier    string            `json:"notifier"`
+		Notifiers   []string          `json:"notifiers,omitempty"`
+		NextSignal  string            `json:"next_signal"`
+		Grace       string            `json:"grace,omitempty"`
+		State       State             `json:"state"`
+		Late        bool              `json:"late"`
+		LastSignal  string            `json:"last_signal,omitempty"`
+		AlertedAt   string            `json:"alerted_at,omitempty"`
+		RecoveredAt string            `json:"recovered_at,omitempty"`
+		AllClear    bool              `json:"all_clear"`
+		Meta        map[string]string `json:"meta,omitempty"`
+		Identity    string            `json:"identity,omitempty"`
+		Reminders   int               `json:"reminders,omitempty"`
+		Step        int               `json:"escalation_step,omitempty"`
+		Ack         *jsonAck          `json:"ack,omitempty"`
+		Kind        notifier.Kind     `json:"alert,omitempty"`
+		DependsOn   []string          `json:"depends_on,omitempty"`
+		Group       string            `json:"group,omitempty"`
+		Rules       *jsonRules        `json:"rules,omitempty"`
+		Runs        *jsonRuns         `json:"runs,omitempty"`
+		Silences    *jsonSilences     `json:"silences,omitempty"`
+		Checks      *jsonChecks       `json:"checks,omitempty"`
+		Learning    *jsonLearning     `json:"learning,omitempty"`
 	}{
-		Name:       nt.signal.Name,
-		Notifier:   nt.signal.Notifier.String(),
-		NextSignal: nt.end.Format(time.RFC3339),
-		AllClear:   nt.signal.AllClear,
-		Meta:       nt.signal.Meta,
+		Name:        nt.signal.Name,
+		Type:        signalType,
+		Notifier:    nt.signal.Notifier.String(),
+		Notifiers:   notifiers,
+		NextSignal:  formatTime(nt.status.NextSignal),
+		Grace:       formatDuration(nt.signal.Grace),
+		State:       nt.status.State,
+		Late:        nt.status.State == StateLate,
+		LastSignal:  formatTime(nt.status.LastSignal),
+		AlertedAt:   formatTime(nt.status.AlertedAt),
+		RecoveredAt: formatTime(nt.status.RecoveredAt),
+		AllClear:    nt.signal.AllClear,
+		Meta:        nt.signal.Meta,
+		Identity:    nt.signal.Identity,
+		Reminders:   nt.status.Reminders,
+		Step:        nt.status.Step,
+		Ack:         newJSONAck(nt.status.Ack),
+		Kind:        nt.status.Kind,
+		DependsOn:   nt.signal.DependsOn,
+		Group:       nt.nanny.groupOf(Signal(nt.signal)),
+		Rules:       nt.jsonRules(),
+		Runs:        nt.jsonRuns(),
+		Silences:    nt.jsonSilences(),
+		Checks:      nt.jsonChecks(),
+		Learning:    nt.jsonLearning(),
 	})
 }
 
+// jsonRules is JSON representation of schedule and interval rules of the signal.
+type jsonRules struct {
+	Schedule  string         `json:"schedule,omitempty"`
+	Timezone  string         `json:"timezone,omitempty"`
+	Tolerance string         `json:"tolerance,omitempty"`
+	Rules     []IntervalRule `json:"interval_rules,omitempty"`
+	Holidays  string         `json:"holidays,omitempty"`
+}
+
+// jsonRules returns nil when the signal has neither schedule nor interval rules.
+// Must be called with nt.lock held.
+func (nt *Timer) jsonRules() *jsonRules {
+	if nt.signal.Schedule == nil && len(nt.signal.Rules) == 0 {
+		return nil
+	}
+	rules := &jsonRules{Timezone: "UTC", Rules: nt.signal.Rules}
+	if nt.signal.Schedule != nil {
+		rules.Schedule = nt.signal.Schedule.String()
+		rules.Tolerance = nt.signal.Tolerance.String()
+	}
+	if nt.signal.Location != nil {
+		rules.Timezone = nt.signal.Location.String()
+	}
+	if nt.signal.Holidays != nil {
+		rules.Holidays = nt.signal.Holidays.String()
+	}
+	return rules
+}
+
+// jsonRuns is JSON representation of runs of the signal, see Start, and of its
+// failure, see Fail.
+type jsonRuns struct {
+	MaxRuntime  string  `json:"max_runtime,omitempty"`
+	RunStarted  string  `json:"run_started,omitempty"`
+	RunDeadline string  `json:"run_deadline,omitempty"`
+	LastRuntime string  `json:"last_runtime,omitempty"`
+	Factor      float64 `json:"runtime_factor,omitempty"`
+	ExitCode    *int    `json:"exit_code,omitempty"`
+	Log         string  `json:"log,omitempty"`
+}
+
+// jsonRuns returns nil when the signal has no runs. Must be called with nt.lock
+// held.
+func (nt *Timer) jsonRuns() *jsonRuns {
+	runs := jsonRuns{
+		MaxRuntime:  formatDuration(nt.signal.MaxRuntime),
+		RunStarted:  formatTime(nt.status.RunStarted),
+		RunDeadline: formatTime(nt.status.RunDeadline),
+		LastRuntime: formatDuration(nt.status.LastRuntime),
+		Factor:      nt.signal.RuntimeFactor,
+	}
+	// Failure is shown only while alerting because of it.
+	if nt.status.Kind == notifier.KindFailure {
+		runs.ExitCode = &nt.status.ExitCode
+		runs.Log = nt.status.Log
+	}
+	if runs == (jsonRuns{}) {
+		return nil
+	}
+	return &runs
+}
+
+// jsonSilences is JSON representation of what holds back notifications of the
+// signal: silences, alerting dependency and flapping.
+type jsonSilences struct {
+	Silenced    bool   `json:"silenced,omitempty"`
+	HeldBy      string `json:"held_by,omitempty"`
+	FlapWindow  string `json:"flap_window,omitempty"`
+	FlapLimit   int    `json:"flap_threshold,omitempty"`
+	Flapping    bool   `json:"flapping,omitempty"`
+	StablePings int    `json:"stable_pings,omitempty"`
+	StableFor   string `json:"stable_for,omitempty"`
+	Pending     bool   `json:"all_clear_pending,omitempty"`
+}
+
+// jsonSilences returns nil when nothing holds back notifications of the signal.
+// Must be called with nt.lock held.
+func (nt *Timer) jsonSilences() *jsonSilences {
+	silences := jsonSilences{
+		Silenced:    !nt.nanny.silencedUntil(Signal(nt.signal), time.Now()).IsZero(),
+		FlapWindow:  formatDuration(nt.signal.FlapWindow),
+		FlapLimit:   nt.signal.FlapThreshold,
+		Flapping:    nt.status.Flapping,
+		StablePings: nt.signal.StablePings,
+		StableFor:   formatDuration(nt.signal.StableFor),
+		Pending:     nt.status.AllClearPending,
+	}
+	if value, ok := nt.nanny.held.GetStringKey(nt.signal.Name); ok {
+		silences.HeldBy = value.(string)
+	}
+	if silences == (jsonSilences{}) {
+		return nil
+	}
+	return &silences
+}
+
+// jsonChecks is JSON representation of checks of the signal's calls: rate,
+// cooldown of inverse signal, throughput, assertions and progress.
+type jsonChecks struct {
+	MinInterval string             `json:"min_interval,omitempty"`
+	MaxRate     int                `json:"max_rate,omitempty"`
+	RateWindow  string             `json:"rate_window,omitempty"`
+	Early       bool               `json:"early,omitempty"`
+	Frequent    bool               `json:"frequent,omitempty"`
+	Cooldown    string             `json:"cooldown,omitempty"`
+	MinTput     int                `json:"min_throughput,omitempty"`
+	TputWindow  string             `json:"throughput_window,omitempty"`
+	Throughput  *int               `json:"throughput,omitempty"`
+	Assertions  []string           `json:"assertions,omitempty"`
+	Values      map[string]float64 `json:"values,omitempty"`
+	Failed      string             `json:"failed_assertion,omitempty"`
+	StallAfter  string             `json:"stall_after,omitempty"`
+	Progress    *float64           `json:"progress,omitempty"`
+	Progressed  string             `json:"progressed_at,omitempty"`
+}
+
+// jsonChecks returns nil when calls of the signal are not checked. Must be called
+// with nt.lock held.
+func (nt *Timer) jsonChecks() *jsonChecks {
+	s := nt.signal
+	if s.MinInterval == 0 && s.MaxRate == 0 && !s.Inverse && s.MinThroughput == 0 &&
+		len(s.Assertions) == 0 && nt.status.Values == nil && s.StallAfter == 0 {
+		return nil
+	}
+	checks := &jsonChecks{
+		MinInterval: formatDuration(s.MinInterval),
+		MaxRate:     s.MaxRate,
+		RateWindow:  formatDuration(s.RateWindow),
+		Early:       nt.status.Early,
+		Frequent:    nt.status.Frequent,
+		Cooldown:    formatDuration(s.Cooldown),
+		MinTput:     s.MinThroughput,
+		TputWindow:  formatDuration(s.ThroughputWindow),
+		Values:      nt.status.Values,
+		StallAfter:  formatDuration(s.StallAfter),
+	}
+	if s.MinThroughput > 0 && !s.Inverse {
+		total := nt.throughput(time.Now())
+		checks.Throughput = &total
+	}
+	for _, a := range s.Assertions {
+		checks.Assertions = append(checks.Assertions, a.String())
+	}
+	if nt.status.Kind == notifier.KindAssertion {
+		checks.Failed = nt.status.Assertion
+	}
+	// Progress is shown only for signals with stall detection.
+	if s.StallAfter > 0 {
+		checks.Progress = &nt.status.Progress
+		checks.Progressed = formatTime(nt.status.ProgressedAt)
+	}
+	return checks
+}
+
+// jsonLearning is JSON representation of the learned interval, see Intervals.
+type jsonLearning struct {
+	LearnPings int    `json:"learn_pings,omitempty"`
+	Learning   bool   `json:"learning,omitempty"`
+	Learned    string `json:"learned_interval,omitempty"`
+	LearnGrace string `json:"learned_grace,omitempty"`
+}
+
+// jsonLearning returns nil when the signal does not learn its interval. Must be
+// called with nt.lock held.
+func (nt *Timer) jsonLearning() *jsonLearning {
+	learning := jsonLearning{
+		LearnPings: nt.signal.LearnPings,
+		Learning:   nt.learning(),
+		Learned:    formatDuration(nt.status.LearnedInterval),
+		LearnGrace: formatDuration(nt.status.LearnedGrace),
+	}
+	if learning == (jsonLearning{}) {
+		return nil
+	}
+	return &learning
+}
+
+// jsonAck is JSON representation of Ack.
+type jsonAck struct {
+	By    string `json:"by,omitempty"`
+	Note  string `json:"note,omitempty"`
+	At    string `json:"at"`
+	Until string `json:"until,omitempty"`
+}
+
+// newJSONAck returns nil when ack is not set.
+func newJSONAck(ack Ack) *jsonAck {
+	if ack.At.IsZero() {
+		return nil
+	}
+	return &jsonAck{
+		By:    ack.By,
+		Note:  ack.Note,
+		At:    formatTime(ack.At),
+		Until: formatTime(ack.Until),
+	}
+}
+
+// formatDuration formats d, zero duration is formatted as empty string.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// formatTime formats t as RFC3339, zero time is formatted as empty string.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
 func newTimer(s validSignal, nanny *Nanny) *Timer {
-	timer := &Timer{signal: s, nanny: nanny}
-	timer.end = time.Now().Add(timer.signal.NextSignal)
-	// If NextSignal is in the past but needed for all-clear notification do not notify user until Timer is reset
-	if timer.signal.NextSignal.Seconds() > 0 {
-		timer.timer = time.AfterFunc(timer.signal.NextSignal, timer.onExpire)
-	} else {
-		timer.timer = time.AfterFunc(math.MaxInt64, timer.onExpire)
-		timer.timer.Stop()
+	now := time.Now()
+	status := Status{State: StateWaiting, LastSignal: now, Values: s.Values}
+	if s.Inverse {
+		// Registration of inverse signal is not its call.
+		status.LastSignal = time.Time{}
+	}
+	if s.MaxRate > 0 {
+		status.Arrivals = []time.Time{now}
+	}
+	if s.MinThroughput > 0 {
+		status.Tally = []Tally{{At: now, Count: s.Count}}
 	}
+	if s.StallAfter > 0 {
+		status.ProgressedAt = now
+		if s.Progress != nil {
+			status.Progress = *s.Progress
+		}
+	}
+	timer := restoreTimer(s, status, nanny)
+	timer.arm(now)
+	timer.armStall()
 	return timer
 }
 
-// Reset updates the nannyTimers signal to reset the timer
-func (nt *Timer) Reset(vs validSignal) {
+// restoreTimer creates timer in given state, without arming it.
+func restoreTimer(s validSignal, status Status, nanny *Nanny) *Timer {
+	timer := &Timer{signal: s, nanny: nanny}
+	timer.status = status
+	timer.setState(status.State)
+	timer.timer = time.AfterFunc(math.MaxInt64, timer.onExpire)
+	timer.timer.Stop()
+	timer.runTimer = time.AfterFunc(math.MaxInt64, timer.onRunExpire)
+	timer.runTimer.Stop()
+	timer.stallTimer = time.AfterFunc(math.MaxInt64, timer.onStallExpire)
+	timer.stallTimer.Stop()
+	return timer
+}
+
+// setState sets lifecycle state of the timer. Must be called with nt.lock held.
+func (nt *Timer) setState(state State) {
+	nt.status.State = state
+	var alerting int32
+	if state == StateAlerting {
+		alerting = 1
+	}
+	atomic.StoreInt32(&nt.alerting, alerting)
+}
+
+// isAlerting returns true when the timer is alerting, without taking nt.lock.
+func (nt *Timer) isAlerting() bool {
+	return atomic.LoadInt32(&nt.alerting) == 1
+}
+
+// Signal returns copy of the signal this timer was created or last reset with.
+func (nt *Timer) Signal() Signal {
 	nt.lock.Lock()
 	defer nt.lock.Unlock()
+	return Signal(nt.signal)
+}
 
-	nt.signal.Notifier = vs.Notifier
-	nt.signal.NextSignal = vs.NextSignal
-	nt.signal.AllClear = vs.AllClear
-	nt.signal.Meta = vs.Meta
-	nt.end = time.Now().Add(vs.NextSignal)
-	nt.timer.Reset(vs.NextSignal)
+// Status returns snapshot of the timer's lifecycle.
+func (nt *Timer) Status() Status {
+	nt.lock.Lock()
+	defer nt.lock.Unlock()
+	return nt.status
+}
+
+// State returns current lifecycle state of the timer.
+func (nt *Timer) State() State {
+	nt.lock.Lock()
+	defer nt.lock.Unlock()
+	return nt.status.State
+}
+
+// Late returns true when the signal is overdue, but still within its grace period.
+func (nt *Timer) Late() bool {
+	return nt.State() == StateLate
+}
+
+// Reset updates the nannyTimers signal to reset the timer. If the timer was
+// alerting, it is recovered and all-clear notification is sent if requested and
+// the timer is stable. Notification is sent instead when the timer starts
+// flapping.
+func (nt *Timer) Reset(vs validSignal) {
+	nt.lock.Lock()
+	now := time.Now()
+	nt.update(vs)
+	if nt.status.State == StatePaused {
+		// Paused timer only remembers the signal, Resume arms it again.
+		nt.status.LastSignal = now
+		nt.lock.Unlock()
+		return
+	}
+	if nt.signal.Inverse {
+		nt.trip(now)
+		return
+	}
+	if vs.Values != nil {
+		nt.status.Values = vs.Values
+	}
+	if failed := nt.signal.failedAssertion(vs.Values); failed != "" {
+		nt.failAssertion(now, failed)
+		return
+	}
+	if vs.Values == nil && nt.status.State == StateAlerting {
+		// Call without values, e.g. finished run, does not pass failed assertion,
+		// only values which pass all assertions clear it. The program is alive
+		// though, it alerts as silent when it stops calling.
+		if failed := nt.signal.failedAssertion(nt.status.Values); failed != "" {
+			if nt.status.Kind != notifier.KindAssertion {
+				// Silent program called again with its values still failing.
+				nt.failAssertion(now, failed)
+				return
+			}
+			nt.status.LastSignal = now
+			nt.watch(now)
+			nt.schedule()
+			nt.lock.Unlock()
+
+			nt.nanny.changed(nt)
+			return
+		}
+	}
+	warnings := nt.checkRate(now)
+	nt.learn(now)
+	nt.status.LastSignal = now
+	moving := nt.signal.StallAfter == 0 || nt.progress(now, vs.Progress)
+	enough := nt.signal.MinThroughput == 0 || nt.count(now, vs.Count)
+	if !moving {
+		nt.stalled(now, warnings)
+		return
+	}
+	if !enough {
+		// Too few events yet, the timer keeps its state and its deadline, which
+		// moves only when there are enough events. Alerting timer alerts when
+		// the deadline passes, e.g. failed program which keeps calling with
+		// too few events.
+		signalNotifiers := nt.stepNotifiers(0)
+		if nt.status.State == StateAlerting {
+			nt.schedule()
+		}
+		nt.lock.Unlock()
+
+		nt.nanny.changed(nt)
+		nt.warn(signalNotifiers, warnings)
+		return
+	}
+	nt.recover(now, warnings)
+}
+
+// stalled handles call of stalled program, which does not recover until its
+// progress moves. The program is alive though, its next signal is expected as
+// usual and its silent alert changes to stalled. Must be called with nt.lock
+// held, which is released.
+func (nt *Timer) stalled(now time.Time, warnings []notifier.Message) {
+	signalNotifiers := nt.stepNotifiers(0)
+	if nt.status.State != StateAlerting {
+		// Stall timer alerts soon, unless the timer was paused meanwhile.
+		nt.setState(StateWaiting)
+		nt.arm(now)
+		nt.lock.Unlock()
+
+		nt.nanny.changed(nt)
+		nt.warn(signalNotifiers, warnings)
+		return
+	}
+	nt.watch(now)
+	if nt.status.Kind == notifier.KindSilent {
+		nt.timer.Stop()
+		nt.alert(notifier.KindStalled)
+		nt.notify(now, false)
+		nt.warn(signalNotifiers, warnings)
+		return
+	}
+	nt.schedule()
+	nt.lock.Unlock()
+
+	nt.nanny.changed(nt)
+	nt.warn(signalNotifiers, warnings)
+}
+
+// recover moves the timer to waiting state, or recovered state if it was
+// alerting, and sends all-clear and given warnings. Must be called with nt.lock
+// held, which is released.
+func (nt *Timer) recover(now time.Time, warnings []notifier.Message) {
+	var (
+		notifiers []notifier.Notifier
+		allClear  bool
+		msg       notifier.Message
+		previous  = nt.status.State
+		nextState = StateWaiting
+		// Notifiers of early or frequent signals.
+		signalNotifiers = nt.stepNotifiers(0)
+	)
+	if nt.status.Flapping && !nt.flapping(now) && nt.signal.AllClear {
+		// User was notified about flapping, tell them it is over.
+		nt.pendAllClear(now)
+	}
+	if previous == StateAlerting {
+		nextState = StateRecovered
+		nt.status.RecoveredAt = now
+		nt.status.Reminders = 0
+		nt.status.Ack = Ack{}
+		nt.status.Kind = ""
+		switch {
+		case nt.transition(now):
+			notifiers = nt.stepNotifiers(0)
+			msg = nt.flapMessage()
+		case nt.status.Flapping:
+			// All-clear is suppressed as well as alerts.
+		case nt.signal.AllClear && !nt.status.AlertedAt.IsZero():
+			// All-clear is not sent when the alert was silenced the whole time.
+			nt.pendAllClear(now)
+		}
+		if !nt.status.AllClearPending {
+			nt.status.Step = 0
+		}
+	}
+	if nt.status.AllClearPending && !nt.status.Flapping {
+		nt.status.Pings++
+		if nt.stable(now) {
+			notifiers = nt.alertedNotifiers()
+			allClear = true
+			msg = nt.message()
+			switch {
+			case nt.signal.Inverse:
+				msg.Kind = notifier.KindTripped
+			case nt.signal.MinThroughput > 0:
+				msg.Kind = notifier.KindThroughput
+			}
+			nt.status.AllClearPending = false
+			nt.status.Step = 0
+		}
+	}
+	nt.suppressed = false
+	nt.nanny.held.Del(nt.signal.Name)
+	nt.setState(nextState)
+	nt.arm(now)
+	nt.lock.Unlock()
+
+	if previous != nextState {
+		nt.nanny.changed(nt)
+	}
+	if previous == StateAlerting {
+		// Dependent signals may alert now.
+		nt.nanny.recheckSuppressed()
+	}
+	nt.deliver(notifiers, func(notif notifier.Notifier) error {
+		if allClear {
+			return notif.NotifyAllClear(msg)
+		}
+		return notif.Notify(msg)
+	})
+	nt.warn(signalNotifiers, warnings)
+}
+
+// pendAllClear postpones all-clear notification until the timer is stable. Must
+// be called with nt.lock held.
+func (nt *Timer) pendAllClear(now time.Time) {
+	nt.status.AllClearPending = true
+	nt.status.StableSince = now
+	nt.status.Pings = 0
+}
+
+// Acknowledge acknowledges alerting timer, stopping reminders and escalation
+// until ack.Until, or until the program recovers. Returns error when the timer is
+// not alerting.
+func (nt *Timer) Acknowledge(ack Ack) error {
+	nt.lock.Lock()
+	if state := nt.status.State; state != StateAlerting {
+		nt.lock.Unlock()
+		return errors.Errorf("signal is not alerting, it is %s", state)
+	}
+	if ack.At.IsZero() {
+		ack.At = time.Now()
+	}
+	nt.status.Ack = ack
+	nt.timer.Stop()
+	nt.schedule()
+	nt.lock.Unlock()
+
+	nt.nanny.changed(nt)
+	return nil
 }
 
-// ResetAllClear updates the nannyTimers signal to reset the timer
-func (nt *Timer) ResetAllClear(vs validSignal) {
-	nt.notifyAllClear()
+// Pause stops the timer until Resume is called, no notifications are sent in
+// the meantime.
+func (nt *Timer) Pause() {
+	nt.lock.Lock()
+	nt.setState(StatePaused)
+	nt.timer.Stop()
+	nt.runTimer.Stop()
+	nt.stallTimer.Stop()
+	nt.lock.Unlock()
+
+	nt.nanny.changed(nt)
+}
 
+// Resume resumes paused timer, next signal is expected within NextSignal from
+// now.
+func (nt *Timer) Resume() {
+	nt.lock.Lock()
+	if nt.status.State != StatePaused {
+		nt.lock.Unlock()
+		return
+	}
+	now := time.Now()
+	nt.setState(StateWaiting)
+	nt.arm(now)
+	nt.armRun()
+	if nt.signal.StallAfter > 0 {
+		// Progress must move within StallAfter from now.
+		nt.status.ProgressedAt = now
+		nt.armStall()
+	}
+	nt.lock.Unlock()
+
+	nt.nanny.changed(nt)
+}
+
+// Stop stops the timer, no more notifications will be sent.
+func (nt *Timer) Stop() {
 	nt.lock.Lock()
 	defer nt.lock.Unlock()
 
+	nt.stopped = true
+	nt.timer.Stop()
+	nt.runTimer.Stop()
+	nt.stallTimer.Stop()
+}
+
+// update must be called with nt.lock held.
+func (nt *Timer) update(vs validSignal) {
+	// Signals declared in config do not know their caller.
+	if vs.Identity != "" {
+		nt.signal.Identity = vs.Identity
+	}
+	if vs.Declared {
+		nt.signal.Declared = true
+	}
 	nt.signal.Notifier = vs.Notifier
+	nt.signal.Notifiers = vs.Notifiers
 	nt.signal.NextSignal = vs.NextSignal
+	nt.signal.Deadline = vs.Deadline
+	nt.signal.Grace = vs.Grace
 	nt.signal.AllClear = vs.AllClear
+	nt.signal.Repeat = vs.Repeat
+	nt.signal.Escalation = vs.Escalation
 	nt.signal.Meta = vs.Meta
-	nt.end = time.Now().Add(vs.NextSignal)
-	nt.timer.Reset(vs.NextSignal)
+	nt.signal.Schedule = vs.Schedule
+	nt.signal.Location = vs.Location
+	nt.signal.Tolerance = vs.Tolerance
+	nt.signal.Rules = vs.Rules
+	nt.signal.Holidays = vs.Holidays
+	nt.signal.MaxRuntime = vs.MaxRuntime
+	nt.signal.DependsOn = vs.DependsOn
+	nt.signal.FlapWindow = vs.FlapWindow
+	nt.signal.FlapThreshold = vs.FlapThreshold
+	nt.signal.StablePings = vs.StablePings
+	nt.signal.StableFor = vs.StableFor
+	nt.signal.MinInterval = vs.MinInterval
+	nt.signal.MaxRate = vs.MaxRate
+	nt.signal.RateWindow = vs.RateWindow
+	nt.signal.Inverse = vs.Inverse
+	nt.signal.Cooldown = vs.Cooldown
+	nt.signal.MinThroughput = vs.MinThroughput
+	nt.signal.ThroughputWindow = vs.ThroughputWindow
+	nt.signal.Assertions = vs.Assertions
+	nt.signal.StallAfter = vs.StallAfter
+	nt.signal.RuntimeFactor = vs.RuntimeFactor
+	nt.signal.LearnPings = vs.LearnPings
+}
+
+// arm sets the next signal deadline for a signal received now. Must be called with nt.lock
+// held.
+func (nt *Timer) arm(now time.Time) {
+	if nt.signal.Inverse {
+		// Inverse timer does not expect any signal.
+		nt.status.NextSignal = time.Time{}
+		return
+	}
+	if nt.learning() {
+		// Learning timer does not expect any signal yet.
+		nt.status.NextSignal = time.Time{}
+		nt.timer.Stop()
+		return
+	}
+	nt.status.NextSignal = nt.nextSignal(now)
+	nt.wake(nt.status.NextSignal)
+}
+
+// watch sets the next signal deadline of alerting timer which was called without
+// recovering, e.g. with failed assertion or stalled, so that it alerts as silent when the
+// program stops calling, see silentAt. Must be called with nt.lock held.
+func (nt *Timer) watch(now time.Time) {
+	if nt.signal.Inverse || nt.learning() {
+		nt.status.NextSignal = time.Time{}
+		return
+	}
+	nt.status.NextSignal = nt.nextSignal(now)
+}
+
+// silentAt returns when alerting timer of the program which keeps calling is
+// silent, or misses its throughput, or zero time when its alert covers it or
+// the program's call recovers it. Must be called with nt.lock held.
+func (nt *Timer) silentAt() time.Time {
+	if nt.status.NextSignal.IsZero() {
+		return time.Time{}
+	}
+	switch nt.status.Kind {
+	case notifier.KindAssertion, notifier.KindStalled:
+	case notifier.KindSilent, notifier.KindThroughput, notifier.KindTripped:
+		return time.Time{}
+	default:
+		if nt.signal.MinThroughput == 0 {
+			// Any call recovers the timer.
+			return time.Time{}
+		}
+	}
+	return nt.status.NextSignal.Add(nt.grace())
+}
+
+// nextSignal returns the next signal deadline for a signal received at given
+// time. Must be called with nt.lock held.
+func (nt *Timer) nextSignal(now time.Time) time.Time {
+	switch {
+	case nt.adaptive():
+		return now.Add(nt.interval())
+	case nt.signal.MinThroughput > 0:
+		return nt.throughputDeadline(now)
+	default:
+		return nt.signal.deadline(now)
+	}
+}
+
+// reschedule updates settings of the signal like update and moves its deadline
+// when they change it, e.g. interval or schedule. The deadline is counted from
+// the last signal, or from now with first deadline when the program never
+// called. Returns true when the deadline was moved. Must be called with nt.lock
+// held.
+func (nt *Timer) reschedule(vs validSignal, first time.Duration) bool {
+	now := time.Now()
+	last := nt.status.LastSignal
+	if last.IsZero() {
+		last = now
+		if nt.expected.IsZero() {
+			// Restored program which never called is expected since start.
+			nt.expected = now
+		}
+	}
+	previous := nt.nextSignal(last)
+	nt.update(vs)
+
+	switch nt.status.State {
+	case StateWaiting, StateRecovered, StateLate:
+	default:
+		// Alerting and paused timers are armed when they are reset.
+		return false
+	}
+	if nt.signal.Inverse || nt.learning() || nt.nextSignal(last).Equal(previous) {
+		return false
+	}
+	if nt.status.State == StateLate {
+		nt.setState(StateWaiting)
+	}
+	if nt.status.LastSignal.IsZero() && first > 0 {
+		nt.status.NextSignal = now.Add(first)
+		nt.wake(nt.status.NextSignal)
+		return true
+	}
+	nt.arm(last)
+	return true
+}
+
+// wake resets the timer to call onExpire at given time. Must be called with
+// nt.lock held.
+func (nt *Timer) wake(at time.Time) {
+	nt.timer.Reset(time.Until(at))
 }
 
+// resume arms restored timer according to its state. Must be called with
+// nt.lock held.
+func (nt *Timer) resume() {
+	if nt.status.State != StatePaused {
+		nt.armRun()
+		nt.armStall()
+	}
+	if (nt.signal.Inverse || nt.learning()) && nt.status.State != StateAlerting {
+		return
+	}
+	switch nt.status.State {
+	case StatePaused:
+	case StateAlerting:
+		if nt.status.AlertedAt.IsZero() {
+			// Nobody was notified yet, the alert was silenced.
+			nt.wake(time.Now())
+			return
+		}
+		nt.schedule()
+	case StateLate:
+		nt.wake(nt.status.NextSignal.Add(nt.grace()))
+	default:
+		nt.setState(StateWaiting)
+		nt.wake(nt.status.NextSignal)
+	}
+}
+
+// onExpire is called first when the program did not signal in time and then
+// again for each reminder or escalation step, until the timer is reset.
 func (nt *Timer) onExpire() {
-	err := nt.notify()
-	if err != nil {
-		// Add context to the error message and call ErrorFunc.
-		err = errors.Wrapf(err, "error calling notifier: %T with signal: %+v", nt.signal.Notifier, nt.signal)
-		if nt.nanny.ErrorFunc == nil {
-			defaultErrorFunc(err)
-		} else {
-			nt.nanny.ErrorFunc(err)
+	nt.lock.Lock()
+	if nt.stopped {
+		nt.lock.Unlock()
+		return
+	}
+
+	now := time.Now()
+	first := false
+	if nt.signal.Inverse {
+		switch {
+		case nt.status.State != StateAlerting:
+			nt.lock.Unlock()
+			return
+		case !now.Before(nt.status.LastSignal.Add(nt.signal.Cooldown)):
+			// No signal during the cool-down, the program is fine again.
+			nt.recover(now, nil)
+			return
+		}
+	}
+	switch nt.status.State {
+	case StateWaiting, StateRecovered:
+		if nt.learning() || now.Before(nt.status.NextSignal) {
+			// Timer was reset in the meantime.
+			nt.lock.Unlock()
+			return
+		}
+		if end := nt.status.NextSignal.Add(nt.grace()); now.Before(end) {
+			nt.setState(StateLate)
+			nt.wake(end)
+			nt.lock.Unlock()
+			nt.nanny.changed(nt)
+			return
+		}
+		first = true
+	case StateLate:
+		if now.Before(nt.status.NextSignal.Add(nt.grace())) {
+			nt.lock.Unlock()
+			return
+		}
+		first = true
+	case StateAlerting:
+		if silent := nt.silentAt(); !silent.IsZero() && !now.Before(silent) {
+			// The program stopped calling, or reported too few events, which is
+			// a new alert.
+			first = true
+			break
+		}
+		if nt.status.Ack.Active(now) {
+			// Acknowledged in the meantime.
+			nt.lock.Unlock()
+			return
+		}
+		// Acknowledgement, if any, expired, continue with the escalation.
+		nt.status.Ack = Ack{}
+	default:
+		nt.lock.Unlock()
+		return
+	}
+	if first {
+		kind := notifier.KindSilent
+		if nt.signal.MinThroughput > 0 {
+			kind = notifier.KindThroughput
 		}
+		nt.alert(kind)
+	}
+	nt.notify(now, first)
+}
+
+// alert moves the timer to alerting state because of given kind of event. Must be
+// called with nt.lock held.
+func (nt *Timer) alert(kind notifier.Kind) {
+	nt.setState(StateAlerting)
+	nt.status.Kind = kind
+	nt.status.AlertedAt = time.Time{}
+	nt.status.Step = 0
+	nt.status.Reminders = 0
+	nt.status.Ack = Ack{}
+	nt.status.AllClearPending = false
+	nt.status.Pings = 0
+	nt.flapStarted = nt.transition(time.Now())
+}
+
+// notify sends notification of alerting timer, unless it is silenced, held back
+// by alerting dependency, member of a group or flapping, and schedules the next
+// one. Must be called with
+// nt.lock held, which is released.
+func (nt *Timer) notify(now time.Time, first bool) {
+	if parent := nt.nanny.alertingDependency(Signal(nt.signal)); parent != "" {
+		// Alert is held back and mentioned in the dependency's notifications,
+		// checked again when the dependency stops alerting.
+		nt.suppressed = true
+		nt.nanny.held.Set(nt.signal.Name, parent)
+		nt.lock.Unlock()
+
+		nt.nanny.changed(nt)
+		nt.callback(first)
+		return
 	}
+	nt.nanny.held.Del(nt.signal.Name)
+
+	if nt.status.Kind == notifier.KindSilent && nt.nanny.groupOf(Signal(nt.signal)) != "" {
+		// Silent member of a group, the group notifies when it loses its quorum.
+		// Other alerts of the member, e.g. failure, notify as usual.
+		nt.suppressed = true
+		nt.lock.Unlock()
 
-	// Call callback if set.
+		nt.nanny.changed(nt)
+		nt.callback(first)
+		return
+	}
+
+	if until := nt.nanny.silencedUntil(Signal(nt.signal), now); !until.IsZero() {
+		// Notification is suppressed, check again when the silence ends.
+		nt.suppressed = true
+		nt.wake(until)
+		nt.lock.Unlock()
+
+		nt.nanny.changed(nt)
+		nt.callback(first)
+		return
+	}
+	if nt.status.Flapping && nt.flapping(now) {
+		// Alerts are suppressed until the timer is stable, checked again when
+		// the flap window passes. User is notified once it starts flapping.
+		nt.suppressed = true
+		var (
+			notifiers []notifier.Notifier
+			msg       notifier.Message
+		)
+		if nt.flapStarted {
+			nt.flapStarted = false
+			notifiers = nt.stepNotifiers(0)
+			msg = nt.flapMessage()
+		}
+		nt.wake(nt.flapEnd())
+		nt.lock.Unlock()
+
+		nt.nanny.changed(nt)
+		nt.deliver(notifiers, func(notif notifier.Notifier) error {
+			return notif.Notify(msg)
+		})
+		nt.callback(first)
+		return
+	}
+	nt.suppressed = false
+
+	if nt.status.AlertedAt.IsZero() {
+		nt.status.AlertedAt = now
+	} else {
+		nt.escalate(now)
+	}
+	nt.status.NotifiedAt = now
+	notifiers := nt.notifiers()
+	msg := nt.message()
+	nt.schedule()
+	nt.lock.Unlock()
+
+	nt.nanny.changed(nt)
+	nt.deliver(notifiers, func(notif notifier.Notifier) error {
+		return notif.Notify(msg)
+	})
+	nt.callback(first)
+}
+
+// callback calls CallbackFunc if set, only for the first alert.
+func (nt *Timer) callback(first bool) {
+	if !first {
+		return
+	}
 	nt.lock.Lock()
 	if nt.signal.CallbackFunc != nil {
 		signal := Signal(nt.signal)
@@ -100,34 +1011,171 @@ func (nt *Timer) onExpire() {
 	nt.lock.Unlock()
 }
 
-func (nt *Timer) notify() error {
+// recheck wakes alerting timer with suppressed notification, so that the
+// silences are checked again.
+func (nt *Timer) recheck() {
 	nt.lock.Lock()
 	defer nt.lock.Unlock()
-	name := "Nanny"
-	if nt.nanny.Name != "" {
-		name = nt.nanny.Name
+
+	if nt.suppressed && nt.status.State == StateAlerting && !nt.stopped {
+		nt.wake(time.Now())
 	}
+}
 
-	return nt.signal.Notifier.Notify(notifier.Message{
-		Nanny:      name,
-		Program:    nt.signal.Name,
-		NextSignal: nt.signal.NextSignal,
-		Meta:       nt.signal.Meta,
-	})
+// steps returns the whole escalation chain, the signal's Notifier being the first
+// step.
+func (nt *Timer) steps() []EscalationStep {
+	steps := []EscalationStep{{Notifier: nt.signal.Notifier, Repeat: nt.signal.Repeat}}
+	return append(steps, nt.signal.Escalation...)
 }
 
-func (nt *Timer) notifyAllClear() error {
-	nt.lock.Lock()
-	defer nt.lock.Unlock()
+// escalate moves to the next escalation step when it is due, or counts another
+// reminder of the current step. Must be called with nt.lock held.
+func (nt *Timer) escalate(now time.Time) {
+	steps := nt.steps()
+	if nt.status.Step+1 < len(steps) && !now.Before(nt.status.AlertedAt.Add(steps[nt.status.Step+1].After)) {
+		nt.status.Step++
+	}
+	nt.status.Reminders++
+}
+
+// schedule resets the timer to the next reminder or escalation step, if there is
+// any. Acknowledged timer is woken up only when the acknowledgement expires.
+// Inverse timer is woken up when it cools down as well, timer of the program
+// which keeps calling when it is silent. Must be called with nt.lock held.
+func (nt *Timer) schedule() {
+	var next time.Time
+	if !nt.status.Ack.At.IsZero() {
+		next = nt.status.Ack.Until
+	} else {
+		next = nt.nextReminder()
+	}
+	if nt.signal.Inverse {
+		end := nt.status.LastSignal.Add(nt.signal.Cooldown)
+		if next.IsZero() || end.Before(next) {
+			next = end
+		}
+	}
+	if silent := nt.silentAt(); !silent.IsZero() && (next.IsZero() || silent.Before(next)) {
+		next = silent
+	}
+	if next.IsZero() {
+		return
+	}
+	nt.wake(next)
+}
+
+// nextReminder returns when the next reminder or escalation step is due, or zero
+// time if there is none. Must be called with nt.lock held.
+func (nt *Timer) nextReminder() time.Time {
+	steps := nt.steps()
+	if nt.status.Step >= len(steps) {
+		// Escalation steps were changed, continue with the last one.
+		nt.status.Step = len(steps) - 1
+	}
+	var next time.Time
+	if repeat := steps[nt.status.Step].Repeat; repeat > 0 {
+		next = nt.status.NotifiedAt.Add(repeat)
+	}
+	if nt.status.Step+1 < len(steps) {
+		escalation := nt.status.AlertedAt.Add(steps[nt.status.Step+1].After)
+		if next.IsZero() || escalation.Before(next) {
+			next = escalation
+		}
+	}
+	return next
+}
+
+// notifiers returns notifiers of given escalation step, the first step notifies
+// all of the signal's notifiers. Must be called with nt.lock held.
+func (nt *Timer) stepNotifiers(step int) []notifier.Notifier {
+	if step == 0 {
+		return append([]notifier.Notifier{nt.signal.Notifier}, nt.signal.Notifiers...)
+	}
+	return []notifier.Notifier{nt.signal.Escalation[step-1].Notifier}
+}
+
+// notifiers returns notifiers of the current escalation step. Must be called
+// with nt.lock held.
+func (nt *Timer) notifiers() []notifier.Notifier {
+	return nt.stepNotifiers(nt.status.Step)
+}
+
+// alertedNotifiers returns every notifier that was used during the escalation.
+// Must be called with nt.lock held.
+func (nt *Timer) alertedNotifiers() []notifier.Notifier {
+	var notifiers []notifier.Notifier
+	for step := 0; step <= nt.status.Step && step < len(nt.steps()); step++ {
+		for _, notif := range nt.stepNotifiers(step) {
+			if !containsNotifier(notifiers, notif) {
+				notifiers = append(notifiers, notif)
+			}
+		}
+	}
+	return notifiers
+}
+
+// deliver calls send for each notifier concurrently, see Nanny.deliver.
+func (nt *Timer) deliver(notifiers []notifier.Notifier, send func(notifier.Notifier) error) {
+	nt.nanny.deliver("signal: "+nt.signal.Name, notifiers, send)
+}
+
+// message must be called with nt.lock held.
+func (nt *Timer) message() notifier.Message {
 	name := "Nanny"
 	if nt.nanny.Name != "" {
 		name = nt.nanny.Name
 	}
 
-	return nt.signal.Notifier.NotifyAllClear(notifier.Message{
+	nextSignal := nt.interval()
+	switch {
+	case nt.status.Kind == notifier.KindRuntime:
+		nextSignal = nt.status.RunDeadline.Sub(nt.status.RunStarted)
+	case nt.status.Kind == notifier.KindAnomaly:
+		nextSignal = nt.anomalyAfter()
+	case nt.status.Kind == notifier.KindStalled:
+		nextSignal = nt.signal.StallAfter
+	case nt.signal.Inverse:
+		nextSignal = nt.signal.Cooldown
+	case nt.signal.MinThroughput > 0:
+		nextSignal = nt.signal.ThroughputWindow
+	case nt.status.LastSignal.IsZero() && !nt.expected.IsZero():
+		// Program which never called is reported with time since it is expected.
+		nextSignal = time.Since(nt.expected).Round(time.Second)
+	case nt.signal.Schedule != nil:
+		// Scheduled programs are reported with time since the last signal.
+		nextSignal = time.Since(nt.status.LastSignal).Round(time.Second)
+	}
+
+	var count, limit int
+	if nt.signal.MinThroughput > 0 {
+		count = nt.throughput(time.Now())
+		limit = nt.signal.MinThroughput
+	}
+
+	return notifier.Message{
 		Nanny:      name,
 		Program:    nt.signal.Name,
-		NextSignal: nt.signal.NextSignal,
+		NextSignal: nextSignal,
+		Kind:       nt.status.Kind,
+		Dependents: nt.nanny.heldBy(nt.signal.Name),
+		ExitCode:   nt.status.ExitCode,
+		Log:        nt.status.Log,
+		Assertion:  nt.status.Assertion,
+		Progress:   nt.status.Progress,
 		Meta:       nt.signal.Meta,
-	})
+		Reminder:   nt.status.Reminders,
+		Step:       nt.status.Step,
+		Count:      count,
+		Limit:      limit,
+	}
+}
+
+func containsNotifier(notifiers []notifier.Notifier, n notifier.Notifier) bool {
+	for _, notif := range notifiers {
+		if notif == n {
+			return true
+		}
+	}
+	return false
 }
@@ -2,6 +2,8 @@ package notifier
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,22 +14,111 @@ type Notifier interface {
 	String() string
 }
 
+// Kind is the kind of event a Message is about.
+type Kind string
+
+const (
+	// KindSilent means the program did not signal in time.
+	KindSilent Kind = "silent"
+	// KindRuntime means the program started a run and did not finish it in time.
+	KindRuntime Kind = "runtime"
+	// KindFailure means the program reported its failure.
+	KindFailure Kind = "failure"
+	// KindQuorum means too few members of a group are alive.
+	KindQuorum Kind = "quorum"
+	// KindFlapping means the program alternates between alerting and recovered.
+	KindFlapping Kind = "flapping"
+	// KindEarly means the program signalled sooner than its minimum interval.
+	KindEarly Kind = "early"
+	// KindFrequent means the program signalled more often than its maximum rate.
+	KindFrequent Kind = "frequent"
+	// KindTripped means the program, which should never signal, signalled.
+	KindTripped Kind = "tripped"
+	// KindThroughput means the program reported too few events within throughput window.
+	KindThroughput Kind = "throughput"
+	// KindAssertion means values reported by the program failed an assertion.
+	KindAssertion Kind = "assertion"
+	// KindStalled means the program signals, but its progress did not move.
+	KindStalled Kind = "stalled"
+	// KindAnomaly means the program's run takes much longer than its previous runs.
+	KindAnomaly Kind = "anomaly"
+)
+
 // Message is used with Notifier's Notify to customise messages sent via different
 // channels.
 type Message struct {
 	Nanny      string        // Nanny's name
 	Program    string        // Program's name
-	NextSignal time.Duration // How long have we not heard from program.
+	NextSignal time.Duration // How long have we not heard from program, maximum or usual runtime of the run, minimum interval, flap, rate or throughput window, cool-down or stall timeout.
+	Kind       Kind          // What happened, KindSilent when empty.
+	Dependents []string      // Programs depending on this one, which are silent as well.
+	ExitCode   int           // Exit code of the failed program, for KindFailure.
+	Log        string        // Optional log excerpt of the failed program, for KindFailure.
+	Assertion  string        // Description of the failed assertion, for KindAssertion.
+	Progress   float64       // Last progress of the program, for KindStalled.
+	Alive      int           // Number of alive members of the group, for KindQuorum.
+	Members    int           // Number of all members of the group, for KindQuorum.
+	MinAlive   int           // Minimum number of alive members of the group, for KindQuorum.
+	Changes    int           // Number of state changes within flap window, for KindFlapping.
+	Interval   time.Duration // Time since the previous signal, for KindEarly.
+	Count      int           // Number of signals within rate window, for KindFrequent, or events within throughput window, for KindThroughput.
+	Limit      int           // Maximum number of signals within rate window, for KindFrequent, or minimum number of events, for KindThroughput.
 	Meta       map[string]string
+	Reminder   int // How many times was the user already notified, 0 for first notification.
+	Step       int // Escalation step, 0 for the first notifier.
 }
 
 // Format is default Message formatter, used to serialize information for some notifiers.
 // This is intended for future use, mainly the ability to set message format from config
 // or from API.
 func (m *Message) Format() string {
-	return fmt.Sprintf("%s: I did not hear from \"%s\" in %s!", m.Nanny, m.Program, m.NextSignal)
+	var msg string
+	switch m.Kind {
+	case KindRuntime:
+		msg = fmt.Sprintf("%s: \"%s\" started, but did not finish in %s!", m.Nanny, m.Program, m.NextSignal)
+	case KindFailure:
+		msg = fmt.Sprintf("%s: \"%s\" failed with exit code %d!", m.Nanny, m.Program, m.ExitCode)
+	case KindFlapping:
+		msg = fmt.Sprintf("%s: \"%s\" is flapping, it changed state %d times in %s! Alerts are suppressed until it is stable.", m.Nanny, m.Program, m.Changes, m.NextSignal)
+	case KindEarly:
+		msg = fmt.Sprintf("%s: \"%s\" called too early, %s after the previous call, expected at least %s!", m.Nanny, m.Program, m.Interval, m.NextSignal)
+	case KindFrequent:
+		msg = fmt.Sprintf("%s: \"%s\" called too frequently, %d times in %s, expected at most %d!", m.Nanny, m.Program, m.Count, m.NextSignal, m.Limit)
+	case KindTripped:
+		msg = fmt.Sprintf("%s: \"%s\" was tripped, it should never call!", m.Nanny, m.Program)
+	case KindThroughput:
+		msg = fmt.Sprintf("%s: \"%s\" reported only %d events in %s, expected at least %d!", m.Nanny, m.Program, m.Count, m.NextSignal, m.Limit)
+	case KindAssertion:
+		msg = fmt.Sprintf("%s: \"%s\" failed its assertion: %s!", m.Nanny, m.Program, m.Assertion)
+	case KindStalled:
+		msg = fmt.Sprintf("%s: \"%s\" is stalled, its progress did not move from %s in %s!", m.Nanny, m.Program, strconv.FormatFloat(m.Progress, 'g', -1, 64), m.NextSignal)
+	case KindAnomaly:
+		msg = fmt.Sprintf("%s: \"%s\" started, but did not finish in %s, much longer than usual!", m.Nanny, m.Program, m.NextSignal)
+	case KindQuorum:
+		msg = fmt.Sprintf("%s: only %d of %d members of \"%s\" are alive, %d required!", m.Nanny, m.Alive, m.Members, m.Program, m.MinAlive)
+	default:
+		msg = fmt.Sprintf("%s: I did not hear from \"%s\" in %s!", m.Nanny, m.Program, m.NextSignal)
+	}
+	if m.Reminder > 0 {
+		msg = fmt.Sprintf("%s (reminder #%d)", msg, m.Reminder)
+	}
+	if len(m.Dependents) > 0 {
+		msg = fmt.Sprintf("%s Dependent programs held back: \"%s\".", msg, strings.Join(m.Dependents, "\", \""))
+	}
+	if m.Kind == KindFailure && m.Log != "" {
+		msg = fmt.Sprintf("%s\n%s", msg, m.Log)
+	}
+	return msg
 }
 
 func (m *Message) FormatAllClear() string {
+	switch m.Kind {
+	case KindQuorum:
+		return fmt.Sprintf("%s: %d of %d members of \"%s\" are alive again!", m.Nanny, m.Alive, m.Members, m.Program)
+	case KindTripped:
+		return fmt.Sprintf("%s: \"%s\" did not call for %s!", m.Nanny, m.Program, m.NextSignal)
+	case KindThroughput:
+		return fmt.Sprintf("%s: \"%s\" reported %d events in %s again!", m.Nanny, m.Program, m.Count, m.NextSignal)
+	}
 	return fmt.Sprintf("%s: I did hear from \"%s\"!", m.Nanny, m.Program)
 }
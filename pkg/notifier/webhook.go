@@ -62,6 +62,7 @@ func NewWebhook(WebhookURL string,
 func (w *webhookNotifier) Notify(msg Message) error {
 	postBody, _ := json.Marshal(map[string]interface{}{
 		"message": msg.Format(),
+		"kind":    msg.Kind,
 		"meta":    msg.Meta,
 	})
 	request, err := http.NewRequest("POST", w.WebhookURL, bytes.NewBuffer(postBody))
@@ -2,6 +2,9 @@ package storage
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/go-xorm/xorm"
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
@@ -19,7 +22,7 @@ func NewSQLiteDB(dsn string) (Storage, error) {
 		return nil, errors.Wrap(err, "unable to open sqlite database")
 	}
 
-	err = engine.Sync2(new(Signal))
+	err = engine.Sync2(new(Signal), new(Silence), new(Group), new(Run))
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create sqlite table")
 	}
@@ -41,19 +44,112 @@ func (d *sqliteDB) Load() ([]Signal, error) {
 }
 
 func (d *sqliteDB) Save(s Signal) error {
-	sql := "INSERT OR REPLACE INTO `signal` (name, notifier, next_signal, all_clear, meta) VALUES (?, ?, ?, ?, ?)"
-
+	notifiers, err := json.Marshal(s.Notifiers)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify signal notifiers")
+	}
+	escalation, err := json.Marshal(s.Escalation)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify signal escalation")
+	}
 	meta, err := json.Marshal(s.Meta)
 	if err != nil {
 		return errors.Wrap(err, "unable to jsonify signal metadata")
 	}
-	_, err = d.db.Exec(sql, s.Name, s.Notifier, s.NextSignal.UTC(), s.AllClear, meta)
+	dependsOn, err := json.Marshal(s.DependsOn)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify signal dependencies")
+	}
+	transitions, err := jsonTimes(s.Transitions)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify signal transitions")
+	}
+	arrivals, err := jsonTimes(s.Arrivals)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify signal arrivals")
+	}
+	tally := make([]Tally, len(s.Tally))
+	for i, t := range s.Tally {
+		tally[i] = Tally{At: t.At.UTC(), Count: t.Count}
+	}
+	tallyJSON, err := json.Marshal(tally)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify signal tally")
+	}
+	assertions, err := json.Marshal(s.Assertions)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify signal assertions")
+	}
+	reported, err := json.Marshal(s.Values)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify signal values")
+	}
+	intervals, err := json.Marshal(s.Intervals)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify signal intervals")
+	}
+	rules, err := json.Marshal(s.IntervalRules)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify signal interval rules")
+	}
+
+	columns := []string{
+		"name", "notifier", "notifiers", "next_signal", "interval", "grace", "all_clear",
+		"repeat", "escalation", "meta", "state", "last_signal", "alerted_at",
+		"recovered_at", "notified_at", "step", "reminders", "ack_by", "ack_note",
+		"ack_at", "ack_until", "schedule", "timezone", "tolerance", "max_runtime", "kind",
+		"run_started", "run_deadline", "last_runtime", "exit_code", "log",
+		"depends_on", "flap_window", "flap_threshold", "stable_pings", "stable_for",
+		"transitions", "flapping", "all_clear_pending", "stable_since", "pings",
+		"min_interval", "max_rate", "rate_window", "arrivals", "early", "frequent",
+		"inverse", "cooldown", "min_throughput", "throughput_window", "tally",
+		"assertions", "values", "assertion", "stall_after", "progress", "progressed_at",
+		"runtime_factor", "learn_pings", "intervals", "learned_interval", "learned_grace",
+		"interval_rules", "holidays", "identity", "deadline", "declared",
+	}
+	values := []interface{}{
+		s.Name, s.Notifier, notifiers, s.NextSignal.UTC(), s.Interval, s.Grace, s.AllClear,
+		s.Repeat, escalation, meta, s.State, s.LastSignal.UTC(), s.AlertedAt.UTC(),
+		s.RecoveredAt.UTC(), s.NotifiedAt.UTC(), s.Step, s.Reminders, s.AckBy, s.AckNote,
+		s.AckAt.UTC(), s.AckUntil.UTC(), s.Schedule, s.Timezone, s.Tolerance, s.MaxRuntime, s.Kind,
+		s.RunStarted.UTC(), s.RunDeadline.UTC(), s.LastRuntime, s.ExitCode, s.Log,
+		dependsOn, s.FlapWindow, s.FlapThreshold, s.StablePings, s.StableFor,
+		transitions, s.Flapping, s.AllClearPending, s.StableSince.UTC(), s.Pings,
+		s.MinInterval, s.MaxRate, s.RateWindow, arrivals, s.Early, s.Frequent,
+		s.Inverse, s.Cooldown, s.MinThroughput, s.ThroughputWindow, tallyJSON,
+		assertions, reported, s.Assertion, s.StallAfter, s.Progress, s.ProgressedAt.UTC(),
+		s.RuntimeFactor, s.LearnPings, intervals, s.LearnedInterval, s.LearnedGrace,
+		rules, s.Holidays, s.Identity, s.Deadline.UTC(), s.Declared,
+	}
+	err = d.replace("signal", columns, values)
 	if err != nil {
 		return errors.Wrapf(err, "unable to save signal to sqlite: %+v", s)
 	}
 	return nil
 }
 
+// jsonTimes encodes times in UTC, like other times are stored.
+func jsonTimes(times []time.Time) ([]byte, error) {
+	utc := make([]time.Time, len(times))
+	for i, t := range times {
+		utc[i] = t.UTC()
+	}
+	return json.Marshal(utc)
+}
+
+// replace inserts or replaces a row of given table.
+func (d *sqliteDB) replace(table string, columns []string, values []interface{}) error {
+	sql := fmt.Sprintf(
+		"INSERT OR REPLACE INTO `%s` (`%s`) VALUES (?%s)",
+		table,
+		strings.Join(columns, "`, `"),
+		strings.Repeat(", ?", len(columns)-1),
+	)
+
+	_, err := d.db.Exec(append([]interface{}{sql}, values...)...)
+	return err
+}
+
 func (d *sqliteDB) Remove(s Signal) error {
 	if s.Name == "" {
 		return nil
@@ -62,5 +158,128 @@ func (d *sqliteDB) Remove(s Signal) error {
 	if err != nil {
 		return errors.Wrapf(err, "unable to remove sqlite record: %+v", s)
 	}
+	_, err = d.db.Where("signal = ?", s.Name).Delete(&Run{})
+	if err != nil {
+		return errors.Wrapf(err, "unable to remove runs of signal from sqlite: %s", s.Name)
+	}
+	return nil
+}
+
+func (d *sqliteDB) LoadSilences() ([]Silence, error) {
+	var silences []Silence
+	err := d.db.Find(&silences)
+	if err != nil {
+		return silences, errors.Wrap(err, "unable to load silences from sqlite")
+	}
+
+	return silences, nil
+}
+
+func (d *sqliteDB) SaveSilence(s Silence) error {
+	matchers, err := json.Marshal(s.Matchers)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify silence matchers")
+	}
+
+	columns := []string{
+		"id", "matchers", "start", "end", "created_by", "comment", "cron", "duration", "timezone",
+	}
+	values := []interface{}{
+		s.ID, matchers, s.Start.UTC(), s.End.UTC(), s.CreatedBy, s.Comment, s.Cron, s.Duration, s.Timezone,
+	}
+	err = d.replace("silence", columns, values)
+	if err != nil {
+		return errors.Wrapf(err, "unable to save silence to sqlite: %+v", s)
+	}
+	return nil
+}
+
+func (d *sqliteDB) RemoveSilence(s Silence) error {
+	if s.ID == "" {
+		return nil
+	}
+	_, err := d.db.Id(s.ID).Delete(&Silence{})
+	if err != nil {
+		return errors.Wrapf(err, "unable to remove sqlite record: %+v", s)
+	}
+	return nil
+}
+
+func (d *sqliteDB) LoadGroups() ([]Group, error) {
+	var groups []Group
+	err := d.db.Find(&groups)
+	if err != nil {
+		return groups, errors.Wrap(err, "unable to load groups from sqlite")
+	}
+
+	return groups, nil
+}
+
+func (d *sqliteDB) SaveGroup(g Group) error {
+	meta, err := json.Marshal(g.Meta)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify group metadata")
+	}
+	notifiers, err := json.Marshal(g.Notifiers)
+	if err != nil {
+		return errors.Wrap(err, "unable to jsonify group notifiers")
+	}
+
+	columns := []string{
+		"name", "prefix", "meta", "min_alive", "notifier", "notifiers", "all_clear",
+		"state", "alerted_at", "recovered_at",
+	}
+	values := []interface{}{
+		g.Name, g.Prefix, meta, g.MinAlive, g.Notifier, notifiers, g.AllClear,
+		g.State, g.AlertedAt.UTC(), g.RecoveredAt.UTC(),
+	}
+	err = d.replace("group", columns, values)
+	if err != nil {
+		return errors.Wrapf(err, "unable to save group to sqlite: %+v", g)
+	}
+	return nil
+}
+
+func (d *sqliteDB) RemoveGroup(g Group) error {
+	if g.Name == "" {
+		return nil
+	}
+	_, err := d.db.Id(g.Name).Delete(&Group{})
+	if err != nil {
+		return errors.Wrapf(err, "unable to remove sqlite record: %+v", g)
+	}
+	return nil
+}
+
+func (d *sqliteDB) LoadRuns(signal string, limit int) ([]Run, error) {
+	var runs []Run
+	err := d.db.Where("signal = ?", signal).Desc("id").Limit(limit).Find(&runs)
+	if err != nil {
+		return runs, errors.Wrap(err, "unable to load runs from sqlite")
+	}
+
+	// Oldest first.
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+	return runs, nil
+}
+
+func (d *sqliteDB) SaveRun(r Run, limit int) error {
+	columns := []string{"signal", "started", "runtime"}
+	values := []interface{}{r.Signal, r.Started.UTC(), r.Runtime}
+	err := d.replace("run", columns, values)
+	if err != nil {
+		return errors.Wrapf(err, "unable to save run to sqlite: %+v", r)
+	}
+
+	_, err = d.db.Exec(
+		"DELETE FROM `run` WHERE `signal` = ? AND `id` NOT IN "+
+			"(SELECT `id` FROM `run` WHERE `signal` = ? ORDER BY `id` DESC LIMIT ?)",
+		r.Signal, r.Signal, limit,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "unable to remove old runs of signal from sqlite: %s", r.Signal)
+	}
 	return nil
 }
@@ -3,6 +3,7 @@ package storage_test
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -27,9 +28,55 @@ func TestSQLiteDataConsistency(t *testing.T) {
 	signal := storage.Signal{
 		Name:       "test",
 		NextSignal: time.Now(),
+		Interval:   time.Duration(1) * time.Minute,
+		Grace:      time.Duration(30) * time.Second,
 		Notifier:   "stderr",
-		Meta:       map[string]string{"meta": "data"},
+		Notifiers:  []string{"slack"},
+		Repeat:     time.Duration(10) * time.Minute,
+		Escalation: []storage.EscalationStep{
+			{After: time.Duration(15) * time.Minute, Notifier: "email"},
+		},
+		Meta:        map[string]string{"meta": "data"},
+		Schedule:    "0 2 * * *",
+		Timezone:    "Europe/Prague",
+		Tolerance:   time.Duration(90) * time.Minute,
+		DependsOn:   []string{"broker"},
+		FlapWindow:  time.Duration(1) * time.Hour,
+		Transitions: []time.Time{time.Now().Add(-time.Minute), time.Now()},
+		Flapping:    true,
+		Pings:       2,
+		MinInterval: time.Duration(1) * time.Minute,
+		Arrivals:    []time.Time{time.Now()},
+		Frequent:    true,
+		Cooldown:    time.Duration(10) * time.Minute,
+		Tally:       []storage.Tally{{At: time.Now(), Count: 100}},
+		Assertions:  []string{"records > 0"},
+		Values:      map[string]float64{"records": 0},
+		Assertion:   "records = 0, expected records > 0",
+		Progress:    42.5,
+		StallAfter:  time.Duration(30) * time.Minute,
+		LearnPings:  10,
+		Intervals:   []time.Duration{time.Minute},
+		State:       "alerting",
+		Kind:        "runtime",
+		RunStarted:  time.Now(),
+		LastRuntime: time.Duration(5) * time.Minute,
+		ExitCode:    2,
+		Log:         "no space left on device",
+		AlertedAt:   time.Now(),
+		Reminders:   2,
+		AckBy:       "admin",
+		AckNote:     "looking into it",
+		AckAt:       time.Now(),
 	}
+	signal.RuntimeFactor = 2
+	signal.IntervalRules = []storage.IntervalRule{
+		{Days: []string{"mon", "fri"}, From: time.Duration(8) * time.Hour, To: time.Duration(18) * time.Hour, NextSignal: time.Duration(5) * time.Minute},
+	}
+	signal.Holidays = "czech"
+	signal.Identity = "db-1"
+	signal.Deadline = time.Now().Add(time.Hour)
+	signal.Declared = true
 	err := sqliteStorage.Save(signal)
 	if err != nil {
 		t.Errorf("signal save failed: %s", err)
@@ -58,6 +105,14 @@ func compareSignals(t *testing.T, this storage.Signal, other storage.Signal) {
 		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.NextSignal, other.NextSignal)
 	}
 
+	if this.Interval != other.Interval {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Interval, other.Interval)
+	}
+
+	if this.Grace != other.Grace {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Grace, other.Grace)
+	}
+
 	if this.AllClear != other.AllClear {
 		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.AllClear, other.AllClear)
 	}
@@ -66,7 +121,258 @@ func compareSignals(t *testing.T, this storage.Signal, other storage.Signal) {
 		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Notifier, other.Notifier)
 	}
 
+	if this.Repeat != other.Repeat {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Repeat, other.Repeat)
+	}
+
+	if len(this.Escalation) != len(other.Escalation) {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Escalation, other.Escalation)
+	} else {
+		for i := range this.Escalation {
+			if this.Escalation[i] != other.Escalation[i] {
+				t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Escalation, other.Escalation)
+			}
+		}
+	}
+
+	if strings.Join(this.Notifiers, ",") != strings.Join(other.Notifiers, ",") {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Notifiers, other.Notifiers)
+	}
+
 	if this.Meta["meta"] != other.Meta["meta"] {
 		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Meta, other.Meta)
 	}
+
+	if strings.Join(this.DependsOn, ",") != strings.Join(other.DependsOn, ",") {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.DependsOn, other.DependsOn)
+	}
+
+	if this.FlapWindow != other.FlapWindow || this.Flapping != other.Flapping || this.Pings != other.Pings ||
+		len(this.Transitions) != len(other.Transitions) {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this, other)
+	} else {
+		for i := range this.Transitions {
+			if !this.Transitions[i].Equal(other.Transitions[i]) {
+				t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Transitions, other.Transitions)
+			}
+		}
+	}
+
+	if this.Inverse != other.Inverse || this.Cooldown != other.Cooldown ||
+		this.MinThroughput != other.MinThroughput || this.ThroughputWindow != other.ThroughputWindow {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this, other)
+	}
+
+	if strings.Join(this.Assertions, ",") != strings.Join(other.Assertions, ",") ||
+		len(this.Values) != len(other.Values) || this.Values["records"] != other.Values["records"] ||
+		this.Assertion != other.Assertion || this.StallAfter != other.StallAfter || this.Progress != other.Progress ||
+		!this.ProgressedAt.Equal(other.ProgressedAt) || this.RuntimeFactor != other.RuntimeFactor {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this, other)
+	}
+
+	if this.LearnPings != other.LearnPings ||
+		len(this.Intervals) != len(other.Intervals) || (len(this.Intervals) > 0 && this.Intervals[0] != other.Intervals[0]) ||
+		this.LearnedInterval != other.LearnedInterval || this.LearnedGrace != other.LearnedGrace ||
+		this.Identity != other.Identity || !this.Deadline.Equal(other.Deadline) ||
+		this.Declared != other.Declared {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this, other)
+	}
+
+	if this.Holidays != other.Holidays || len(this.IntervalRules) != len(other.IntervalRules) ||
+		strings.Join(this.IntervalRules[0].Days, ",") != strings.Join(other.IntervalRules[0].Days, ",") ||
+		this.IntervalRules[0].From != other.IntervalRules[0].From || this.IntervalRules[0].To != other.IntervalRules[0].To ||
+		this.IntervalRules[0].NextSignal != other.IntervalRules[0].NextSignal {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.IntervalRules, other.IntervalRules)
+	}
+
+	if len(this.Tally) != len(other.Tally) {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Tally, other.Tally)
+	} else {
+		for i := range this.Tally {
+			if !this.Tally[i].At.Equal(other.Tally[i].At) || this.Tally[i].Count != other.Tally[i].Count {
+				t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Tally, other.Tally)
+			}
+		}
+	}
+
+	if this.MinInterval != other.MinInterval || this.Frequent != other.Frequent ||
+		len(this.Arrivals) != len(other.Arrivals) || (len(this.Arrivals) > 0 && !this.Arrivals[0].Equal(other.Arrivals[0])) {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this, other)
+	}
+
+	if this.Schedule != other.Schedule || this.Timezone != other.Timezone || this.Tolerance != other.Tolerance {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this, other)
+	}
+
+	if this.Kind != other.Kind || this.RunStarted.Round(0) != other.RunStarted || this.LastRuntime != other.LastRuntime ||
+		this.ExitCode != other.ExitCode || this.Log != other.Log {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this, other)
+	}
+
+	if this.State != other.State {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.State, other.State)
+	}
+
+	if this.AlertedAt.Round(0) != other.AlertedAt {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.AlertedAt, other.AlertedAt)
+	}
+
+	if !other.RecoveredAt.IsZero() {
+		t.Errorf("zero time should be loaded as zero time, loaded: %+v", other.RecoveredAt)
+	}
+
+	if this.Reminders != other.Reminders {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this.Reminders, other.Reminders)
+	}
+
+	if this.AckBy != other.AckBy || this.AckNote != other.AckNote || this.AckAt.Round(0) != other.AckAt {
+		t.Errorf("saved signal is not equal to loaded signal, saved: %+v, loaded: %+v", this, other)
+	}
+}
+
+// TestSQLiteSilences tests that saved silences are loaded the same.
+func TestSQLiteSilences(t *testing.T) {
+	silence := storage.Silence{
+		ID:        "abc",
+		Matchers:  []storage.Matcher{{Value: "backup-*"}, {Meta: "env", Value: "prod|stage", Regex: true}},
+		Start:     time.Now(),
+		End:       time.Now().Add(time.Hour),
+		CreatedBy: "admin",
+		Comment:   "maintenance",
+		Cron:      "0 2 * * sat",
+		Duration:  time.Duration(2) * time.Hour,
+		Timezone:  "Europe/Prague",
+	}
+	err := sqliteStorage.SaveSilence(silence)
+	if err != nil {
+		t.Errorf("silence save failed: %s", err)
+	}
+
+	silences, err := sqliteStorage.LoadSilences()
+	if err != nil {
+		t.Errorf("silence load failed: %s", err)
+	}
+	if len(silences) != 1 {
+		t.Fatal("there should be exactly 1 silence loaded")
+	}
+	loaded := silences[0]
+	if loaded.ID != silence.ID || loaded.CreatedBy != silence.CreatedBy || loaded.Comment != silence.Comment ||
+		loaded.Cron != silence.Cron || loaded.Duration != silence.Duration || loaded.Timezone != silence.Timezone {
+		t.Errorf("saved silence is not equal to loaded silence, saved: %+v, loaded: %+v", silence, loaded)
+	}
+	if silence.Start.Round(0) != loaded.Start || silence.End.Round(0) != loaded.End {
+		t.Errorf("saved silence is not equal to loaded silence, saved: %+v, loaded: %+v", silence, loaded)
+	}
+	if len(loaded.Matchers) != 2 || loaded.Matchers[0] != silence.Matchers[0] || loaded.Matchers[1] != silence.Matchers[1] {
+		t.Errorf("saved silence is not equal to loaded silence, saved: %+v, loaded: %+v", silence.Matchers, loaded.Matchers)
+	}
+
+	err = sqliteStorage.RemoveSilence(silence)
+	if err != nil {
+		t.Errorf("silence remove failed: %s", err)
+	}
+	silences, err = sqliteStorage.LoadSilences()
+	if err != nil {
+		t.Errorf("silence load failed: %s", err)
+	}
+	if len(silences) != 0 {
+		t.Error("there should be no silence loaded after remove")
+	}
+}
+
+func TestSQLiteGroups(t *testing.T) {
+	group := storage.Group{
+		Name:      "workers",
+		Prefix:    "worker-",
+		Meta:      map[string]string{"role": "worker"},
+		MinAlive:  3,
+		Notifier:  "stderr",
+		Notifiers: []string{"slack"},
+		AllClear:  true,
+		State:     "alerting",
+		AlertedAt: time.Now(),
+	}
+	err := sqliteStorage.SaveGroup(group)
+	if err != nil {
+		t.Errorf("group save failed: %s", err)
+	}
+
+	groups, err := sqliteStorage.LoadGroups()
+	if err != nil {
+		t.Errorf("group load failed: %s", err)
+	}
+	if len(groups) != 1 {
+		t.Fatal("there should be exactly 1 group loaded")
+	}
+	loaded := groups[0]
+	if loaded.Name != group.Name || loaded.Prefix != group.Prefix || loaded.Meta["role"] != group.Meta["role"] ||
+		loaded.MinAlive != group.MinAlive || loaded.Notifier != group.Notifier || loaded.AllClear != group.AllClear ||
+		strings.Join(loaded.Notifiers, ",") != strings.Join(group.Notifiers, ",") {
+		t.Errorf("saved group is not equal to loaded group, saved: %+v, loaded: %+v", group, loaded)
+	}
+	if loaded.State != group.State || group.AlertedAt.Round(0) != loaded.AlertedAt {
+		t.Errorf("saved group is not equal to loaded group, saved: %+v, loaded: %+v", group, loaded)
+	}
+
+	err = sqliteStorage.RemoveGroup(group)
+	if err != nil {
+		t.Errorf("group remove failed: %s", err)
+	}
+	groups, err = sqliteStorage.LoadGroups()
+	if err != nil {
+		t.Errorf("group load failed: %s", err)
+	}
+	if len(groups) != 0 {
+		t.Error("there should be no group loaded after remove")
+	}
+}
+
+func TestSQLiteRuns(t *testing.T) {
+	signal := storage.Signal{Name: "test runs", NextSignal: time.Now()}
+	err := sqliteStorage.Save(signal)
+	if err != nil {
+		t.Errorf("signal save failed: %s", err)
+	}
+	started := time.Now()
+	for i := 1; i <= 3; i++ {
+		err = sqliteStorage.SaveRun(storage.Run{
+			Signal:  signal.Name,
+			Started: started.Add(time.Duration(i) * time.Hour),
+			Runtime: time.Duration(i) * time.Minute,
+		}, 2)
+		if err != nil {
+			t.Errorf("run save failed: %s", err)
+		}
+	}
+
+	runs, err := sqliteStorage.LoadRuns(signal.Name, 2)
+	if err != nil {
+		t.Errorf("run load failed: %s", err)
+	}
+	if len(runs) != 2 {
+		t.Fatal("there should be exactly 2 runs loaded")
+	}
+	if runs[0].Runtime != time.Duration(2)*time.Minute || runs[1].Runtime != time.Duration(3)*time.Minute ||
+		!runs[1].Started.Equal(started.Add(time.Duration(3)*time.Hour)) {
+		t.Errorf("last runs should be loaded oldest first, got: %+v", runs)
+	}
+	runs, err = sqliteStorage.LoadRuns(signal.Name, 10)
+	if err != nil {
+		t.Errorf("run load failed: %s", err)
+	}
+	if len(runs) != 2 || runs[0].Runtime != time.Duration(2)*time.Minute {
+		t.Errorf("runs beyond the limit should be removed, got: %+v", runs)
+	}
+
+	err = sqliteStorage.Remove(signal)
+	if err != nil {
+		t.Errorf("signal remove failed: %s", err)
+	}
+	runs, err = sqliteStorage.LoadRuns(signal.Name, 2)
+	if err != nil {
+		t.Errorf("run load failed: %s", err)
+	}
+	if len(runs) != 0 {
+		t.Errorf("runs should be removed with the signal, got: %+v", runs)
+	}
 }
@@ -11,14 +11,183 @@ type Storage interface {
 	Save(Signal) error
 	Remove(Signal) error
 
+	LoadSilences() ([]Silence, error)
+	SaveSilence(Silence) error
+	RemoveSilence(Silence) error
+
+	LoadGroups() ([]Group, error)
+	SaveGroup(Group) error
+	RemoveGroup(Group) error
+
+	// LoadRuns returns at most limit last runs of given signal, oldest first.
+	LoadRuns(signal string, limit int) ([]Run, error)
+	// SaveRun saves finished run and removes older runs of its signal, so that at
+	// most limit last runs are kept.
+	SaveRun(r Run, limit int) error
+
 	io.Closer
 }
 
 // Signal represents stored signal information
 type Signal struct {
-	Name       string `xorm:"pk"`
-	Notifier   string
-	NextSignal time.Time
-	AllClear   bool `xorm:"default 0"`
-	Meta       map[string]string
+	Name          string `xorm:"pk"`
+	Identity      string // Identity of the caller.
+	Notifier      string
+	Notifiers     []string      // Additional notifiers.
+	NextSignal    time.Time     // When the next signal is expected.
+	Interval      time.Duration `xorm:"default 0"` // Signal's next_signal duration.
+	Deadline      time.Time     // Signal's next_signal time, see nanny.Signal.
+	Declared      bool          `xorm:"default 0"` // Whether the signal is declared in config.
+	Grace         time.Duration `xorm:"default 0"`
+	AllClear      bool          `xorm:"default 0"`
+	Repeat        time.Duration `xorm:"default 0"`
+	Escalation    []EscalationStep
+	Meta          map[string]string
+	Schedule      string        // Cron expression of scheduled signal.
+	Timezone      string        // Time zone of the schedule or interval rules.
+	Tolerance     time.Duration `xorm:"default 0"`
+	MaxRuntime    time.Duration `xorm:"default 0"`
+	DependsOn     []string      // Names of signals this one depends on.
+	FlapWindow    time.Duration `xorm:"default 0"`
+	FlapThreshold int           `xorm:"default 0"`
+	StablePings   int           `xorm:"default 0"`
+	StableFor     time.Duration `xorm:"default 0"`
+	MinInterval   time.Duration `xorm:"default 0"`
+	MaxRate       int           `xorm:"default 0"`
+	RateWindow    time.Duration `xorm:"default 0"`
+	Inverse       bool          `xorm:"default 0"`
+	Cooldown      time.Duration `xorm:"default 0"`
+
+	// Throughput floor of the signal.
+	MinThroughput    int           `xorm:"default 0"`
+	ThroughputWindow time.Duration `xorm:"default 0"`
+
+	// Assertions of reported values, e.g. "records > 0".
+	Assertions []string
+	StallAfter time.Duration `xorm:"default 0"`
+	// Runtime anomaly detection, see Run.
+	RuntimeFactor float64 `xorm:"default 0"`
+	// Learning of the interval when it is not set, see Intervals.
+	LearnPings int `xorm:"default 0"`
+	// Interval rules and name of their holiday calendar.
+	IntervalRules []IntervalRule
+	Holidays      string
+
+	// Lifecycle state of the signal's timer.
+	State       string
+	LastSignal  time.Time
+	AlertedAt   time.Time
+	RecoveredAt time.Time
+	NotifiedAt  time.Time
+	Step        int    `xorm:"default 0"`
+	Reminders   int    `xorm:"default 0"`
+	Kind        string // Kind of the current alert.
+
+	// Acknowledgement of the current alert.
+	AckBy    string
+	AckNote  string
+	AckAt    time.Time
+	AckUntil time.Time
+
+	// Current run of the program and duration of the last one.
+	RunStarted  time.Time
+	RunDeadline time.Time
+	LastRuntime time.Duration `xorm:"default 0"`
+
+	// Last reported failure of the program.
+	ExitCode int `xorm:"default 0"`
+	Log      string
+
+	// Flap detection and all-clear hysteresis.
+	Transitions     []time.Time
+	Flapping        bool `xorm:"default 0"`
+	AllClearPending bool `xorm:"default 0"`
+	StableSince     time.Time
+	Pings           int `xorm:"default 0"`
+
+	// Recent signals, see MinInterval and MaxRate.
+	Arrivals []time.Time
+	Early    bool `xorm:"default 0"`
+	Frequent bool `xorm:"default 0"`
+
+	// Events reported within ThroughputWindow, see MinThroughput.
+	Tally []Tally
+
+	// Values reported by the last signal and the last failed assertion.
+	Values    map[string]float64
+	Assertion string
+
+	// Last reported progress and when it moved, see StallAfter.
+	Progress     float64 `xorm:"default 0"`
+	ProgressedAt time.Time
+
+	// Intervals observed while learning and the learned interval, see LearnPings.
+	Intervals       []time.Duration
+	LearnedInterval time.Duration `xorm:"default 0"`
+	LearnedGrace    time.Duration `xorm:"default 0"`
+}
+
+// Tally represents stored number of events reported by one signal.
+type Tally struct {
+	At    time.Time `json:"at"`
+	Count int       `json:"count"`
+}
+
+// IntervalRule represents stored interval rule of a signal.
+type IntervalRule struct {
+	Days       []string      `json:"days"`
+	From       time.Duration `json:"from"`
+	To         time.Duration `json:"to"`
+	NextSignal time.Duration `json:"next_signal"`
+}
+
+// EscalationStep represents stored escalation step of a signal.
+type EscalationStep struct {
+	After    time.Duration `json:"after"`
+	Notifier string        `json:"notifier"`
+	Repeat   time.Duration `json:"repeat"`
+}
+
+// Silence represents stored silence.
+type Silence struct {
+	ID        string `xorm:"pk 'id'"`
+	Matchers  []Matcher
+	Start     time.Time
+	End       time.Time
+	CreatedBy string
+	Comment   string
+	Cron      string
+	Duration  time.Duration `xorm:"default 0"`
+	Timezone  string
+}
+
+// Matcher represents stored matcher of a silence.
+type Matcher struct {
+	Meta  string `json:"meta"`
+	Value string `json:"value"`
+	Regex bool   `json:"regex"`
+}
+
+// Group represents stored quorum group and its lifecycle state.
+type Group struct {
+	Name      string `xorm:"pk"`
+	Prefix    string
+	Meta      map[string]string
+	MinAlive  int `xorm:"default 0"`
+	Notifier  string
+	Notifiers []string // Additional notifiers.
+	AllClear  bool     `xorm:"default 0"`
+
+	State       string
+	AlertedAt   time.Time
+	RecoveredAt time.Time
+}
+
+// Run represents stored finished run of a signal. Only the last runs of a signal
+// are kept, see SaveRun, and they are removed together with the signal.
+type Run struct {
+	ID      int64  `xorm:"pk autoincr 'id'"`
+	Signal  string `xorm:"index"`
+	Started time.Time
+	Runtime time.Duration `xorm:"default 0"`
 }